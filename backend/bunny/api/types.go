@@ -0,0 +1,100 @@
+// Package api provides types used by the Bunny.net Storage API.
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// timeFormat is the format Bunny uses for LastChanged and DateCreated.
+//
+// The timestamps have no explicit zone but are UTC.
+const timeFormat = "2006-01-02T15:04:05.999"
+
+// DirItem describes a single entry in a directory listing.
+type DirItem struct {
+	Guid            string `json:"Guid"`
+	StorageZoneName string `json:"StorageZoneName"`
+	Path            string `json:"Path"`
+	ObjectName      string `json:"ObjectName"`
+	Length          int64  `json:"Length"`
+	LastChanged     string `json:"LastChanged"`
+	ServerId        int64  `json:"ServerId"`
+	ArrayNumber     int64  `json:"ArrayNumber"`
+	IsDirectory     bool   `json:"IsDirectory"`
+	UserId          string `json:"UserId"`
+	ContentType     string `json:"ContentType"`
+	DateCreated     string `json:"DateCreated"`
+	StorageZoneId   int64  `json:"StorageZoneId"`
+	Checksum        string `json:"Checksum"`
+	ReplicatedZones string `json:"ReplicatedZones"`
+}
+
+// ModTime returns the modification time of the item.
+//
+// The timestamps carry no zone information but are UTC, so they are
+// parsed with that location explicitly. DateCreated is tried when
+// LastChanged is empty or unparseable, and the zero time is returned
+// only when neither yields a usable timestamp.
+func (i *DirItem) ModTime() time.Time {
+	for _, value := range []string{i.LastChanged, i.DateCreated} {
+		if value == "" {
+			continue
+		}
+		if t, err := time.ParseInLocation(timeFormat, value, time.UTC); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// StorageZone describes a storage zone as returned by the management
+// API's /storagezone listing.
+type StorageZone struct {
+	Id                 int64    `json:"Id"`
+	Name               string   `json:"Name"`
+	Region             string   `json:"Region"`
+	ReplicationRegions []string `json:"ReplicationRegions"`
+	StorageUsed        int64    `json:"StorageUsed"`
+	FilesStored        int64    `json:"FilesStored"`
+	DateModified       string   `json:"DateModified"`
+}
+
+// Error is the JSON error body the storage API returns on failure.
+type Error struct {
+	Status    string `json:"-"` // HTTP status line
+	HTTPCode  int    `json:"HttpCode"`
+	Message   string `json:"Message"`
+	ErrorCode int    `json:"ErrorCode"` // bunny specific error code, more precise than the HTTP status
+}
+
+// ErrAuthFailed matches Errors caused by a rejected access key via
+// errors.Is, so callers can tell a bad credential apart from other
+// failures.
+var ErrAuthFailed = errors.New("authentication failed - check the storage zone name and access key")
+
+// Error returns a string for the error and satisfies the error interface
+func (e *Error) Error() string {
+	out := fmt.Sprintf("bunny error %d", e.HTTPCode)
+	if e.Status != "" {
+		out += ": " + e.Status
+	}
+	if e.Message != "" {
+		out += ": " + e.Message
+	}
+	if errors.Is(e, ErrAuthFailed) {
+		out += " (" + ErrAuthFailed.Error() + ")"
+	}
+	return out
+}
+
+// Is reports 401 and 403 errors as ErrAuthFailed.
+func (e *Error) Is(target error) bool {
+	return target == ErrAuthFailed &&
+		(e.HTTPCode == http.StatusUnauthorized || e.HTTPCode == http.StatusForbidden)
+}
+
+// Check Error satisfies the error interface
+var _ error = (*Error)(nil)
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fullListingEntry is a verbatim entry as the storage API returns it.
+const fullListingEntry = `{
+	"Guid": "01234567-89ab-cdef-0123-456789abcdef",
+	"StorageZoneName": "myzone",
+	"Path": "/myzone/dir/",
+	"ObjectName": "file.txt",
+	"Length": 1234,
+	"LastChanged": "2024-01-02T03:04:05.678",
+	"ServerId": 42,
+	"ArrayNumber": 0,
+	"IsDirectory": false,
+	"UserId": "fedcba98-7654-3210-fedc-ba9876543210",
+	"ContentType": "text/plain",
+	"DateCreated": "2024-01-01T00:00:00.000",
+	"StorageZoneId": 1000,
+	"Checksum": "AF2BDBE1AA9B6EC1E2ADE1D694F41FC71A831D0268E9891562113D8A62ADD1BF",
+	"ReplicatedZones": "DE,NY"
+}`
+
+// TestDirItemDecode checks that a full API listing entry decodes and
+// the fields the backend actually uses are populated.
+func TestDirItemDecode(t *testing.T) {
+	var item DirItem
+	require.NoError(t, json.Unmarshal([]byte(fullListingEntry), &item))
+	assert.Equal(t, "01234567-89ab-cdef-0123-456789abcdef", item.Guid)
+	assert.Equal(t, "/myzone/dir/", item.Path)
+	assert.Equal(t, "file.txt", item.ObjectName)
+	assert.Equal(t, int64(1234), item.Length)
+	assert.False(t, item.IsDirectory)
+	assert.Equal(t, "text/plain", item.ContentType)
+	assert.Equal(t, "AF2BDBE1AA9B6EC1E2ADE1D694F41FC71A831D0268E9891562113D8A62ADD1BF", item.Checksum)
+	assert.Equal(t, "DE,NY", item.ReplicatedZones)
+	assert.Equal(t, "myzone", item.StorageZoneName)
+	assert.Equal(t, int64(42), item.ServerId)
+	assert.Equal(t, int64(0), item.ArrayNumber)
+	assert.Equal(t, "fedcba98-7654-3210-fedc-ba9876543210", item.UserId)
+	assert.Equal(t, "2024-01-01T00:00:00.000", item.DateCreated)
+	assert.Equal(t, int64(1000), item.StorageZoneId)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 678000000, time.UTC), item.ModTime())
+}
+
+// TestDirItemModTime checks timestamp parsing is explicitly UTC, with
+// and without fractional seconds, and falls back to DateCreated.
+func TestDirItemModTime(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		lastChanged string
+		dateCreated string
+		want        time.Time
+	}{
+		{
+			name:        "fractional seconds",
+			lastChanged: "2024-01-02T03:04:05.678",
+			want:        time.Date(2024, 1, 2, 3, 4, 5, 678000000, time.UTC),
+		},
+		{
+			name:        "whole seconds",
+			lastChanged: "2024-01-02T03:04:05",
+			want:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			name:        "empty falls back to DateCreated",
+			dateCreated: "2023-12-31T23:59:59.5",
+			want:        time.Date(2023, 12, 31, 23, 59, 59, 500000000, time.UTC),
+		},
+		{
+			name:        "unparseable falls back to DateCreated",
+			lastChanged: "yesterday-ish",
+			dateCreated: "2023-12-31T23:59:59",
+			want:        time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name: "neither usable",
+			want: time.Time{},
+		},
+	} {
+		item := DirItem{LastChanged: test.lastChanged, DateCreated: test.dateCreated}
+		got := item.ModTime()
+		assert.True(t, test.want.Equal(got), "%s: got %v want %v", test.name, got, test.want)
+		if !test.want.IsZero() {
+			assert.Equal(t, time.UTC, got.Location(), test.name)
+		}
+	}
+}
+
+// TestErrorAuthFailed checks 401 and 403 errors match ErrAuthFailed
+// and carry the credential hint in their message, while other codes
+// stay generic.
+func TestErrorAuthFailed(t *testing.T) {
+	for _, test := range []struct {
+		code int
+		auth bool
+	}{
+		{401, true},
+		{403, true},
+		{404, false},
+		{500, false},
+	} {
+		err := &Error{HTTPCode: test.code, Status: "status", Message: "message"}
+		assert.Equal(t, test.auth, errors.Is(err, ErrAuthFailed), "code %d", test.code)
+		if test.auth {
+			assert.Contains(t, err.Error(), "authentication failed", "code %d", test.code)
+		} else {
+			assert.NotContains(t, err.Error(), "authentication failed", "code %d", test.code)
+		}
+	}
+}
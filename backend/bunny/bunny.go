@@ -0,0 +1,4603 @@
+// Package bunny provides an interface to Bunny.net storage zones.
+package bunny
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	gohash "hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/backend/bunny/api"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/fshttp"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/encoder"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/rest"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	endpointURL   = "https://storage.bunnycdn.com"
+	mgmtURL       = "https://api.bunny.net"
+	minSleep      = 10 * time.Millisecond
+	maxSleep      = time.Minute
+	decayConstant = 1 // bigger for slower decay, exponential
+	listCacheTTL  = 5 * time.Second
+	retryAfter    = 5 * time.Second
+
+	// futureModTimeSlack is how far ahead of the local clock a
+	// timestamp may be before future_modtime_policy applies, allowing
+	// for ordinary clock skew.
+	futureModTimeSlack = time.Hour
+
+	// xattrHeader carries serialized user metadata on an object.
+	xattrHeader = "X-Rclone-Xattrs"
+	// xattrHeaderLimit is the largest serialized metadata blob which
+	// will be stored in a header - anything bigger goes in a sidecar.
+	xattrHeaderLimit = 4096
+	// metadataSidecarSuffix names the sidecar object used when the
+	// metadata is too big for a header.
+	metadataSidecarSuffix = ".rclone-metadata"
+	// originalNameHeader records the pre-transliteration name of an
+	// object stored under a transliterated name.
+	originalNameHeader = "X-Rclone-Original-Name"
+	// mtimeHeader stores the source modification time of an upload,
+	// since bunny only tracks when the object last changed on the
+	// zone.
+	mtimeHeader = "X-Rclone-Mtime"
+
+	// defaultEncoding covers the characters bunny can't store as-is:
+	// backslashes, control characters, invalid UTF-8 and leading or
+	// trailing spaces.
+	defaultEncoding = encoder.Display |
+		encoder.EncodeBackSlash |
+		encoder.EncodeLeftSpace |
+		encoder.EncodeRightSpace |
+		encoder.EncodeInvalidUtf8
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "bunny",
+		Description: "Bunny.net Storage Zone",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `User metadata (including extended attributes) is stored serialized in the ` + xattrHeader + ` header on the object, falling back to a sidecar object with the suffix ` + metadataSidecarSuffix + ` when too large for a header.`,
+		},
+		Options: []fs.Option{{
+			Name:     "storage_zone",
+			Help:     "Name of the storage zone to connect to.",
+			Required: true,
+		}, {
+			Name:      "access_key",
+			Help:      "Storage zone password, also used as the API access key.",
+			Required:  true,
+			Sensitive: true,
+		}, {
+			Name: "storage_endpoint",
+			Help: `Storage endpoint or region code to connect to.
+
+Zones replicated outside the primary Falkenstein (DE) region are
+served from regional hosts like ny.storage.bunnycdn.com, and using
+the wrong one adds significant latency. Give a friendly region code
+such as "ny" to use the matching regional host, or a full URL to use
+it verbatim. Leave empty for the main endpoint.`,
+			Default: "",
+			Examples: []fs.OptionExample{{
+				Value: "",
+				Help:  "Main endpoint, Falkenstein (DE) region (default).",
+			}, {
+				Value: "ny",
+				Help:  "New York region.",
+			}, {
+				Value: "la",
+				Help:  "Los Angeles region.",
+			}, {
+				Value: "sg",
+				Help:  "Singapore region.",
+			}, {
+				Value: "syd",
+				Help:  "Sydney region.",
+			}, {
+				Value: "uk",
+				Help:  "London region.",
+			}, {
+				Value: "se",
+				Help:  "Stockholm region.",
+			}, {
+				Value: "br",
+				Help:  "Sao Paulo region.",
+			}},
+		}, {
+			Name: "auto_region",
+			Help: `Probe the regional endpoints at startup and use the fastest.
+
+Instead of picking a storage_endpoint by hand, this probes each
+regional endpoint with a lightweight listing request when the remote
+starts up and selects the one answering fastest; regions which don't
+serve the zone are skipped. The choice is cached for the life of the
+process so repeated uses of the remote don't re-probe. If no probe
+succeeds the configured endpoint is kept.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "api_key",
+			Help: `Account API key for the Bunny.net management API.
+
+Only needed for operations which go through the management API such as
+clearing the read-only flag on objects or purging the pull zone cache
+with the purge-cache backend command.`,
+			Advanced:  true,
+			Sensitive: true,
+		}, {
+			Name: "pull_zone_hostname",
+			Help: `Hostname of a pull zone attached to the storage zone.
+
+Storage zones are served publicly through an attached pull zone, so
+this is needed for PublicLink (rclone link) to work. Give just the
+hostname, e.g. "myzone.b-cdn.net", or a custom hostname configured on
+the pull zone.`,
+			Advanced: true,
+		}, {
+			Name: "token_auth_key",
+			Help: `Token authentication key of the pull zone.
+
+If the pull zone has token authentication enabled, set this to its
+URL token authentication key and PublicLink will generate signed URLs
+which expire after the requested duration. Without it links are plain
+unsigned URLs.`,
+			Advanced:  true,
+			Sensitive: true,
+		}, {
+			Name: "download_via_cdn",
+			Help: `Download through the pull zone instead of the storage origin.
+
+Reads are served from the CDN hostname configured with
+pull_zone_hostname, which is edge-cached and usually faster than the
+storage origin. Files the CDN doesn't have yet fall back to the
+origin automatically, so freshly uploaded files still download. With
+token_auth_key set the CDN requests are signed.
+
+Note that the CDN may serve a cached copy for a while after a file
+changes - use the purge-cache backend command to force it fresh.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "retryable_codes",
+			Help: `Comma separated list of bunny error codes to treat as retryable.
+
+bunny's JSON error bodies carry an error code which indicates
+retryable vs permanent conditions more precisely than the HTTP status.
+Responses whose body carries one of these codes are retried whatever
+the status.`,
+			Default:  "",
+			Advanced: true,
+		}, {
+			Name:     "pacer_min_sleep",
+			Help:     "Minimum time to sleep between API calls.",
+			Default:  fs.Duration(minSleep),
+			Advanced: true,
+		}, {
+			Name:     "pacer_max_sleep",
+			Help:     "Maximum time to sleep between API calls when backing off.",
+			Default:  fs.Duration(maxSleep),
+			Advanced: true,
+		}, {
+			Name: "pacer_decay_constant",
+			Help: `Decay constant for the pacer - how quickly the sleep time recovers after errors.
+
+Bigger values make the sleep time decay more slowly back towards
+pacer_min_sleep once errors stop.`,
+			Default:  decayConstant,
+			Advanced: true,
+		}, {
+			Name: "missing_modtime_policy",
+			Help: `What ModTime should return for objects whose timestamp can't be parsed.
+
+"zero" returns the zero time, which is stable across runs and so
+doesn't cause sync churn. "now" returns the time the object was first
+seen, which makes --max-age/--min-age filtering work at the cost of
+changing between runs. "error" makes NewObject fail for such objects
+so they can't be silently mis-synced.`,
+			Default:  "zero",
+			Advanced: true,
+			Examples: []fs.OptionExample{{
+				Value: "zero",
+				Help:  "Return the zero time (default, no sync churn).",
+			}, {
+				Value: "now",
+				Help:  "Return the time the object was first seen.",
+			}, {
+				Value: "error",
+				Help:  "Fail lookups of objects with unparseable timestamps.",
+			}},
+		}, {
+			Name: "purge_state_file",
+			Help: `Local file recording paths already deleted by a purge.
+
+When set, every path successfully deleted during a purge is appended
+to this file and paths already recorded are skipped, so an interrupted
+purge of a huge tree can be resumed without re-attempting deletes.
+The file is removed once a purge completes without failures.`,
+			Default:  "",
+			Advanced: true,
+		}, {
+			Name: "strict_names",
+			Help: `If set, reject path segments ending in a dot with a clear error.
+
+Directory names with a trailing dot round-trip through the storage
+API but are mishandled by some clients and filesystems. With this set
+such names are refused up front instead of creating objects which may
+be hard to access elsewhere.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "future_modtime_policy",
+			Help: `What to do with objects whose timestamp is implausibly far in the future.
+
+Clock skew or bad uploads can leave objects dated in the future,
+which breaks --max-age/--min-age logic. Timestamps more than an hour
+ahead are handled per this policy: "keep" uses them as stored,
+"clamp" replaces them with the current time, and "warn" keeps them
+but logs a warning per object.`,
+			Default:  "keep",
+			Advanced: true,
+			Examples: []fs.OptionExample{{
+				Value: "keep",
+				Help:  "Use the stored timestamp as is (default).",
+			}, {
+				Value: "clamp",
+				Help:  "Replace future timestamps with the current time.",
+			}, {
+				Value: "warn",
+				Help:  "Keep future timestamps but log a warning.",
+			}},
+		}, {
+			Name: "probe_mode",
+			Help: `How NewObject checks whether an object exists.
+
+"list" fetches the parent directory listing. "range" issues a
+single-byte ranged GET against the object URL instead, which is
+cheaper for large directories and also validates reachability when
+HEAD is blocked by an intermediary. If the ranged response is
+ambiguous the listing is used as a fallback.`,
+			Default:  "list",
+			Advanced: true,
+			Examples: []fs.OptionExample{{
+				Value: "list",
+				Help:  "Look the object up in the parent directory listing.",
+			}, {
+				Value: "range",
+				Help:  "Probe the object with a single-byte ranged GET.",
+			}},
+		}, {
+			Name: "no_head",
+			Help: `Don't use HEAD requests to find objects.
+
+By default NewObject checks for an object with a single HEAD request
+and only falls back to the parent directory listing when the response
+can't fully describe it. Set this to always use directory listings
+instead, which can be cheaper when many objects in the same directory
+are looked up in a row.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "http_cache_proxy",
+			Help: `URL of a local HTTP caching proxy to route downloads through.
+
+When set, Open requests are issued via this proxy so repeated
+downloads of the same objects (e.g. in CI) can be served from the
+cache. Writes and deletes always go direct to the storage endpoint.
+
+Note that the AccessKey header is still sent on proxied requests as
+the origin requires it, so only use a proxy you trust.`,
+			Default:  "",
+			Advanced: true,
+		}, {
+			Name: "purge_partial_policy",
+			Help: `What to do when some deletes fail during a purge.
+
+With "abort" the purge stops at the first failed delete. With
+"continue" the remaining objects are still deleted and the failures
+are aggregated into a single error listing the paths which couldn't be
+removed. In both cases the directory itself is only removed once it
+has been fully emptied.`,
+			Default:  "abort",
+			Advanced: true,
+			Examples: []fs.OptionExample{{
+				Value: "abort",
+				Help:  "Stop the purge at the first failed delete.",
+			}, {
+				Value: "continue",
+				Help:  "Keep deleting and report all failures at the end.",
+			}},
+		}, {
+			Name: "list_cache_time",
+			Help: `How long to cache directory listings for.
+
+Listings fetched for List and NewObject are reused within this window
+so repeated lookups in the same directory, as happen constantly
+during a sync, don't each hit the network. The cache is dropped for a
+directory as soon as anything in it is changed through this remote.
+Set to 0 to disable caching.`,
+			Default:  fs.Duration(listCacheTTL),
+			Advanced: true,
+		}, {
+			Name: "list_cache_dir",
+			Help: `Directory to persist the listing cache in.
+
+When set, directory listings are written to this directory as well as
+held in memory, so a fresh rclone process can reuse listings fetched
+by an earlier one while they are within the cache TTL. Entries are
+keyed by storage zone, root and directory. Useful for very large zones
+queried repeatedly by short-lived processes.`,
+			Default:  "",
+			Advanced: true,
+		}, {
+			Name: "list_concurrency",
+			Help: `Maximum number of directory listings to fetch at once.
+
+Recursive walks can fan out into many simultaneous listing requests,
+which on large zones is enough to trip the API rate limits on its
+own. Set this to bound how many listings are in flight at a time,
+independently of the transfer concurrency - the pacer still governs
+the timing of the individual requests. 0 means no limit.`,
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name: "read_buffer_size",
+			Help: `Buffer size for download streams.
+
+Downloads are read through a buffer of this size so workloads which
+issue many small reads (as some mount configurations do) don't pay
+per-read network overhead. Set to 0 to disable buffering and read
+straight from the response body.`,
+			Default:  fs.SizeSuffix(64 * 1024),
+			Advanced: true,
+		}, {
+			Name: "write_buffer_size",
+			Help: `Buffer size for upload streams.
+
+Sources which produce data in small pieces are accumulated into a
+buffer of this size before being streamed to the storage endpoint, so
+the transport sees large writes instead of a dribble of tiny ones.
+Set to 0 to disable buffering and stream the source directly.`,
+			Default:  fs.SizeSuffix(64 * 1024),
+			Advanced: true,
+		}, {
+			Name: "timeout",
+			Help: `Cap on how long any single storage request may take.
+
+Applied as a context deadline to every request including uploads and
+downloads, so a stalled streaming body is cut off too. It works
+alongside metadata_timeout and transfer_timeout - whichever deadline
+is soonest wins - and a request cut off by it surfaces a timeout error
+which the pacer retries like any other retryable failure. Set to 0
+(the default) to rely on the global rclone timeouts only.`,
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}, {
+			Name: "metadata_timeout",
+			Help: `Deadline for metadata operations such as listings and deletes.
+
+Metadata calls move no payload and should complete quickly, so they
+get a short fixed deadline independent of transfer_timeout. Set to 0
+to apply no backend specific deadline.`,
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}, {
+			Name: "transfer_timeout",
+			Help: `Base deadline for uploads and downloads.
+
+Transfers get this long plus an extra second per MiB of payload, so
+the deadline scales with the size of the object being moved and large
+objects which legitimately take a long time aren't cut off by a limit
+sized for small ones. Transfers of unknown size get no deadline. Set
+to 0 to apply no backend specific deadline.`,
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}, {
+			Name: "retry_on_corruption",
+			Help: `How many times to retry a download whose checksum doesn't match.
+
+When set, whole-object downloads of objects with a known SHA256 are
+read in full and verified before being handed to the caller, and
+fetched again from scratch up to this many times when the content
+doesn't match the stored checksum. This can recover from transient
+edge cache corruption, at the cost of buffering each download in
+memory, so it is best suited to zones of small objects. Ranged reads
+and objects without a stored checksum are returned unverified. Set to
+0 to disable verification.`,
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name: "verify_download",
+			Help: `Verify downloads against the stored SHA256 as they stream.
+
+Whole-object downloads of objects with a known checksum are hashed on
+the fly and the read fails at the end if the content doesn't match
+the stored SHA256, catching corruption in transit without buffering
+anything. Unlike retry_on_corruption the download isn't retried, just
+failed. Ranged reads and objects without a stored checksum are
+returned unverified.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "metadata_headers",
+			Help: `Comma separated list of response headers to surface as metadata.
+
+When object metadata is fetched with a HEAD request, each of these
+response headers which is present is added to the metadata map keyed
+by its lower-cased name. Headers not on the list are dropped, so the
+metadata output stays clean and predictable however many headers the
+CDN adds to responses.`,
+			Default:  "ETag,Cache-Control,Content-Disposition,Content-Encoding",
+			Advanced: true,
+		}, {
+			Name: "expose_raw_metadata",
+			Help: `Include every raw listing field in object metadata.
+
+When set, the lesser-used fields bunny returns for an object - Guid,
+ServerId, ArrayNumber, UserId, StorageZoneId, DateCreated and so on -
+are added to the metadata map under "bunny-" prefixed keys. Useful
+for deep debugging and auditing; off by default to keep the metadata
+output small.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "large_dir_threshold",
+			Help: `Warn when a directory listing has at least this many entries.
+
+bunny returns each directory listing as a single JSON document, so
+directories with hundreds of thousands of entries balloon memory. The
+first time a listing reaches this threshold a warning is logged
+suggesting the layout be split up or listed by narrower prefixes. Set
+to 0 to disable the warning.`,
+			Default:  100000,
+			Advanced: true,
+		}, {
+			Name: "move_overwrite_policy",
+			Help: `When Move should overwrite an existing destination object.
+
+bunny has no server side rename, so a move re-uploads the object and
+deletes the source. "always" overwrites an existing destination
+unconditionally. "if-newer" skips the re-upload when the destination
+already has the same content (by checksum, falling back to the source
+not being newer when checksums aren't known) and just deletes the
+source, which avoids unnecessary writes during reorganizations.`,
+			Default:  "always",
+			Advanced: true,
+			Examples: []fs.OptionExample{{
+				Value: "always",
+				Help:  "Always overwrite the destination (default).",
+			}, {
+				Value: "if-newer",
+				Help:  "Only overwrite when the source differs by checksum or is newer.",
+			}},
+		}, {
+			Name: "max_idle_conns",
+			Help: `Maximum idle connections to keep in the connection pool.
+
+The listing and transfer paths share one HTTP client so mixed
+workloads reuse the same connections. When this (or
+idle_conn_timeout) is set the backend builds its own tuned transport
+for that client instead of using rclone's global one, keeping up to
+this many idle connections ready for reuse. Set to 0 to stay on the
+global transport with its defaults.`,
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name: "idle_conn_timeout",
+			Help: `How long an idle connection is kept in the connection pool.
+
+Only applies when the backend builds its own tuned transport - see
+max_idle_conns. Set to 0 to keep the transport default.`,
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}, {
+			Name: "pack_small_files",
+			Help: `Pack files smaller than this into shared pack objects.
+
+Uploading thousands of tiny files is bound by per-request latency.
+bunny has no batch upload endpoint, so when this is set files below
+the threshold are accumulated in memory and written as a single JSON
+pack object per directory (flushed when the pack grows big enough and
+on shutdown). Listings expand packs back into their files and reads
+are served from the pack, so the packing is transparent to callers -
+but note the packed files only exist in the zone once the pack has
+been flushed, and rewriting a packed file stores it individually
+again. Set to 0 to store every file as its own object.`,
+			Default:  fs.SizeSuffix(0),
+			Advanced: true,
+		}, {
+			Name: "allow_root_purge",
+			Help: `Allow Purge to delete the root of the storage zone.
+
+Purging the zone root deletes every object in the zone, which is
+usually a mistake, so it is refused unless this is set.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "scrub_concurrency",
+			Help: `How many objects the scrub command verifies in parallel.
+
+The scrub is download-bound, so a large zone verifies much faster
+with several downloads in flight. Each worker streams its object
+through the hash rather than buffering it, so raising this costs
+little memory, and the pacer still governs request timing. The
+command's -o concurrency flag overrides this per run.`,
+			Default:  4,
+			Advanced: true,
+		}, {
+			Name: "delete_wait",
+			Help: `How long to wait after a delete for the object to stop being visible.
+
+Deletes are eventually consistent, so an object can linger in
+listings briefly after Remove or Purge returns. With this set, the
+remote polls after each delete - with HEAD requests for a removed
+object, by re-listing for a purged directory - until the deletion is
+visible or this much time has passed, giving tight scripts
+read-after-delete consistency. Set to 0 to return as soon as the
+delete is accepted.`,
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}, {
+			Name: "list_retry_on_empty",
+			Help: `How many times to retry a listing missing a recently written object.
+
+The zone is eventually consistent, so a listing taken right after an
+upload can come back without the new object and make a sync think it
+went missing. With this set, this remote remembers what it uploaded
+in the last minute, and a listing which should contain one of those
+objects but doesn't (including a directory 404 right after the upload
+that created it) is re-fetched up to this many times with increasing
+backoff before the result is accepted. Set to 0 to accept listings
+as they come.`,
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name: "proactive_throttle",
+			Help: `Slow down when the zone reports a low remaining rate-limit budget.
+
+When responses carry an X-RateLimit-Remaining header, this watches it
+and starts spacing requests out once the remaining budget drops to
+10 or below - the lower the budget, the longer the gap - so transfers
+stay under the limit instead of running into 429s and the retry
+backoff they bring. Requests return to full speed as soon as the
+budget recovers.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "serialize_same_path",
+			Help: `Serialize concurrent writes to the same path client-side.
+
+bunny storage is last-writer-wins, so two concurrent uploads to the
+same path race on the stored content and on this remote's listing
+cache. With this set, writes and deletes to the same path take a
+per-path lock within this remote, so they run one at a time and the
+cache ends up consistent with whichever write finished last. This
+only serializes operations going through a single rclone instance.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "strip_prefix",
+			Help: `Path prefix to strip from listed names and re-add for operations.
+
+This re-roots the remote below the given prefix without changing the
+configured root: listings return names relative to the prefix, and
+every operation prepends it again before talking to the zone. Useful
+when the path the zone stores is deeper than the base you want to
+work with.`,
+			Default:  "",
+			Advanced: true,
+		}, {
+			Name: "checksum_manifest",
+			Help: `Local manifest file supplying SHA256 checksums for uploads.
+
+When restoring from a backup with a known-good manifest (such as one
+written by upload_manifest - a JSON array of path/size/sha256
+entries), uploads whose source can't supply a SHA256 look the path up
+here and send the manifest checksum as the Checksum header instead of
+going without, so the zone still verifies the transfer and no local
+recomputation is needed.`,
+			Default:  "",
+			Advanced: true,
+		}, {
+			Name: "copy_checkpoint",
+			Help: `Local checkpoint file recording completed uploads for resumable copies.
+
+When copying a huge tree, an interrupted run normally starts over.
+With this set, every completed upload whose checksum is known is
+recorded in the file, and a re-run skips uploads whose path and
+SHA256 match a recorded entry - a changed source no longer matches
+and is uploaded again. Delete the file to force a full copy.`,
+			Default:  "",
+			Advanced: true,
+		}, {
+			Name: "chunk_size",
+			Help: `Chunk size for multi-chunk uploads of large files.
+
+Files uploaded through the chunked upload path are read from the
+source in chunks of this size, with upload_concurrency parallel
+reads, spooled to a local temporary file and uploaded in a single
+PUT. A failed chunk is re-read on its own instead of restarting the
+whole transfer. Needs free disk space for one file's worth of
+spool.`,
+			Default:  defaultChunkSize,
+			Advanced: true,
+		}, {
+			Name: "upload_concurrency",
+			Help: `How many chunks of the same file to read in parallel.
+
+Only used by the chunked upload path - single PUT uploads read the
+source on one connection regardless.`,
+			Default:  defaultUploadConcurrency,
+			Advanced: true,
+		}, {
+			Name: "user_agent",
+			Help: `User-Agent header to send on storage and management requests.
+
+Useful for identifying this remote's traffic in the zone logs or for
+zones which filter by user agent. Left empty, requests carry rclone's
+standard user agent string.`,
+			Default:  "",
+			Advanced: true,
+		}, {
+			Name: "disable_checksum",
+			Help: `Don't compute or send SHA256 checksums on upload.
+
+Normally every upload is hashed and carries a Checksum header so the
+zone verifies the transfer. Hashing can be costly when the source is
+slow to read twice (e.g. another remote), so with this set uploads
+skip the hash and the header, and the backend stops advertising
+SHA256 for comparisons. The zone still returns the checksum it stored,
+so downloads can be verified after the fact.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "upload_manifest",
+			Help: `Name of a manifest object summarizing uploads, written to the zone root.
+
+When set, every object uploaded through this remote is recorded and on
+shutdown a JSON manifest listing each uploaded object's path (relative
+to the zone root), size and SHA256 is written to this object at the
+root of the storage zone. This gives archival transfers a single
+object to verify against later.`,
+			Default:  "",
+			Advanced: true,
+		}, {
+			Name: "name_collision_policy",
+			Help: `What NewObject should do when a name is both a file and a directory.
+
+bunny's path model allows a file "foo" and a directory "foo/" to exist
+side by side. "prefer-file" resolves the name to the file,
+"prefer-dir" treats it as a directory (lookups fail with an is-a-
+directory error) and "error" refuses to resolve the ambiguity.`,
+			Default:  "prefer-file",
+			Advanced: true,
+			Examples: []fs.OptionExample{{
+				Value: "prefer-file",
+				Help:  "Resolve the name to the file (default).",
+			}, {
+				Value: "prefer-dir",
+				Help:  "Treat the name as the directory.",
+			}, {
+				Value: "error",
+				Help:  "Fail lookups of ambiguous names.",
+			}},
+		}, {
+			Name: "dir_move_policy",
+			Help: `What DirMove should do when the destination directory exists.
+
+bunny has no server side rename, so a directory move re-uploads each
+object within the zone and then deletes the source. When the
+destination directory already exists "error" refuses the move, "merge"
+relocates the source entries into the existing directory (overwriting
+files with the same name) and "replace" deletes the existing
+destination first.`,
+			Default:  "error",
+			Advanced: true,
+			Examples: []fs.OptionExample{{
+				Value: "error",
+				Help:  "Refuse the move with a directory exists error (default).",
+			}, {
+				Value: "merge",
+				Help:  "Move the source entries into the existing directory.",
+			}, {
+				Value: "replace",
+				Help:  "Delete the existing destination directory first.",
+			}},
+		}, {
+			Name: "circuit_breaker_failures",
+			Help: `Consecutive connection failures after which to pause requests.
+
+When this many requests in a row fail at the connection level - the
+edge being unreachable rather than returning an HTTP error - the
+backend stops issuing requests for circuit_breaker_cooldown, then lets
+a single probe request through. If the probe succeeds normal operation
+resumes, otherwise the pause starts again. Set to 0 to disable.`,
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name:     "circuit_breaker_cooldown",
+			Help:     "How long to pause requests for once the circuit breaker opens.",
+			Default:  fs.Duration(30 * time.Second),
+			Advanced: true,
+		}, {
+			Name: "transliterate",
+			Help: `If set, replace characters bunny can't store in object names with "_".
+
+Non-ASCII and control characters are mapped to an underscore when the
+object is stored and the original name is recorded in the ` + originalNameHeader + `
+header so it can be recovered on download - it is surfaced as the
+"original-name" metadata key. Note that listings show the stored
+(transliterated) names and that two names which transliterate
+identically refer to the same stored object.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "clear_read_only",
+			Help: `If set, attempt to clear the read-only flag on objects before overwriting or deleting them.
+
+This uses the management API and so requires api_key to be set.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name:     config.ConfigEncoding,
+			Help:     config.ConfigEncodingHelp,
+			Advanced: true,
+			Default:  defaultEncoding,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	StorageZone        string        `config:"storage_zone"`
+	AccessKey          string        `config:"access_key"`
+	StorageEndpoint    string        `config:"storage_endpoint"`
+	AutoRegion         bool          `config:"auto_region"`
+	APIKey             string        `config:"api_key"`
+	PullZoneHostname   string        `config:"pull_zone_hostname"`
+	TokenAuthKey       string        `config:"token_auth_key"`
+	DownloadViaCDN     bool          `config:"download_via_cdn"`
+	RetryableCodes     string        `config:"retryable_codes"`
+	PacerMinSleep      fs.Duration   `config:"pacer_min_sleep"`
+	PacerMaxSleep      fs.Duration   `config:"pacer_max_sleep"`
+	PacerDecayConstant int           `config:"pacer_decay_constant"`
+	MissingModtime     string        `config:"missing_modtime_policy"`
+	FutureModtime      string        `config:"future_modtime_policy"`
+	ProbeMode          string        `config:"probe_mode"`
+	NoHead             bool          `config:"no_head"`
+	HTTPCacheProxy     string        `config:"http_cache_proxy"`
+	PurgePartialPolicy string        `config:"purge_partial_policy"`
+	PurgeStateFile     string        `config:"purge_state_file"`
+	ClearReadOnly      bool          `config:"clear_read_only"`
+	StrictNames        bool          `config:"strict_names"`
+	Transliterate      bool          `config:"transliterate"`
+	DirMovePolicy      string        `config:"dir_move_policy"`
+	CopyCheckpoint     string        `config:"copy_checkpoint"`
+	UploadManifest     string        `config:"upload_manifest"`
+	ChunkSize          fs.SizeSuffix `config:"chunk_size"`
+	UploadConcurrency  int           `config:"upload_concurrency"`
+	DisableChecksum    bool          `config:"disable_checksum"`
+	UserAgent          string        `config:"user_agent"`
+	ListCacheTime      fs.Duration   `config:"list_cache_time"`
+	ListCacheDir       string        `config:"list_cache_dir"`
+	ListConcurrency    int           `config:"list_concurrency"`
+	ExposeRawMetadata  bool          `config:"expose_raw_metadata"`
+
+	NameCollisionPolicy string `config:"name_collision_policy"`
+
+	ReadBufferSize  fs.SizeSuffix `config:"read_buffer_size"`
+	WriteBufferSize fs.SizeSuffix `config:"write_buffer_size"`
+
+	Timeout         fs.Duration `config:"timeout"`
+	MetadataTimeout fs.Duration `config:"metadata_timeout"`
+	TransferTimeout fs.Duration `config:"transfer_timeout"`
+
+	RetryOnCorruption int    `config:"retry_on_corruption"`
+	VerifyDownload    bool   `config:"verify_download"`
+	MetadataHeaders   string `config:"metadata_headers"`
+	LargeDirThreshold int    `config:"large_dir_threshold"`
+
+	MoveOverwritePolicy string `config:"move_overwrite_policy"`
+
+	MaxIdleConns    int         `config:"max_idle_conns"`
+	IdleConnTimeout fs.Duration `config:"idle_conn_timeout"`
+
+	PackSmallFiles fs.SizeSuffix `config:"pack_small_files"`
+
+	AllowRootPurge bool `config:"allow_root_purge"`
+
+	ProactiveThrottle bool        `config:"proactive_throttle"`
+	SerializeSamePath bool        `config:"serialize_same_path"`
+	StripPrefix       string      `config:"strip_prefix"`
+	ListRetryOnEmpty  int         `config:"list_retry_on_empty"`
+	DeleteWait        fs.Duration `config:"delete_wait"`
+	ScrubConcurrency  int         `config:"scrub_concurrency"`
+
+	ChecksumManifest string `config:"checksum_manifest"`
+
+	CircuitBreakerFailures int         `config:"circuit_breaker_failures"`
+	CircuitBreakerCooldown fs.Duration `config:"circuit_breaker_cooldown"`
+
+	Enc encoder.MultiEncoder `config:"encoding"`
+}
+
+// Fs represents a remote bunny storage zone
+type Fs struct {
+	name       string        // name of this remote
+	root       string        // the path we are working on if any
+	opt        Options       // parsed config options
+	features   *fs.Features  // optional features
+	endpoint   string        // storage endpoint in use
+	srv        *rest.Client  // client for listing calls
+	httpClient *http.Client  // client for uploads and downloads
+	readClient *http.Client  // client for downloads, possibly via a cache proxy
+	mgmt       *rest.Client  // client for the management API
+	pacer      *fs.Pacer     // pacer for API calls
+	cache      *listCache    // directory listing cache
+	listSem    chan struct{} // bounds in-flight listing fetches for list_concurrency, nil for no limit
+
+	retryableCodes map[int]bool // bunny error codes to retry on
+
+	manifestMu sync.Mutex               // protects manifest
+	manifest   map[string]manifestEntry // uploads recorded for upload_manifest
+
+	manifestHashes map[string]string // checksums loaded from checksum_manifest, by full path
+
+	pathLocksMu sync.Mutex           // protects pathLocks
+	pathLocks   map[string]*pathLock // per-path write locks for serialize_same_path
+
+	recentMu     sync.Mutex           // protects recentWrites
+	recentWrites map[string]time.Time // uploads tracked for list_retry_on_empty
+
+	checkpoint *copyCheckpoint // completed uploads for copy_checkpoint
+
+	metricsMu   sync.Mutex   // protects metricsHook
+	metricsHook func(Metric) // called after every API request when set
+
+	largeDirMu     sync.Mutex      // protects largeDirWarned
+	largeDirWarned map[string]bool // directories already warned about for large_dir_threshold
+
+	packMu      sync.Mutex              // protects the pack state below
+	packPending map[string]*pendingPack // unflushed small files by directory
+	packCache   map[string]*packDoc     // decoded pack objects by remote, never mutated once stored
+	packSeq     int                     // counter for unique pack names
+	packNames   map[string]string       // current pack object name by directory
+	packWriteMu sync.Mutex              // serializes pack object writes
+}
+
+// manifestEntry is one uploaded object in the upload manifest
+type manifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Object describes a bunny object
+type Object struct {
+	fs              *Fs
+	remote          string
+	size            int64
+	modTime         time.Time
+	sha256          string
+	contentType     string
+	id              string // bunny Guid
+	replicatedZones string // regions the object is replicated to
+	// metaComplete is set when the object's system metadata was fully
+	// populated from a listing response. User metadata lives in the
+	// xattr header or a sidecar object which listings can't carry, so
+	// Metadata still makes a per object request for it unless the
+	// object can't have any (pack entries).
+	metaComplete bool
+	// hasSidecar is set when the listing the object came from showed a
+	// metadata sidecar next to it, so Metadata can skip probing for
+	// one otherwise.
+	hasSidecar bool
+	// probed is set when the object was built from a probe response,
+	// which lacks listing-only fields such as the Guid and the
+	// replicated zones. They are filled in lazily when needed.
+	probed bool
+	// modTimeMissing is set when the object's timestamp couldn't be
+	// parsed and modTime holds whatever missing_modtime_policy chose.
+	modTimeMissing bool
+	// packed is set when the object lives inside a pack object (see
+	// pack_small_files); packRemote names that pack, or is "" while
+	// the file is still pending in memory.
+	packed     bool
+	packRemote string
+	// raw is the listing entry the object came from, kept only when
+	// expose_raw_metadata is set so Metadata can surface every field.
+	raw *api.DirItem
+}
+
+// DirList is a directory listing as returned by the storage API
+type DirList []api.DirItem
+
+// Files returns the non-directory items of the listing as Objects
+// rooted at dir
+func (l DirList) Files(f *Fs, dir string) (objs []*Object) {
+	// Note which objects have a metadata sidecar so Metadata doesn't
+	// have to probe for one
+	sidecars := map[string]bool{}
+	for i := range l {
+		if name := l[i].ObjectName; !l[i].IsDirectory && strings.HasSuffix(name, metadataSidecarSuffix) {
+			sidecars[strings.TrimSuffix(name, metadataSidecarSuffix)] = true
+		}
+	}
+	for i := range l {
+		item := &l[i]
+		if item.IsDirectory {
+			continue
+		}
+		// Metadata sidecars are an implementation detail so don't show them
+		if strings.HasSuffix(item.ObjectName, metadataSidecarSuffix) {
+			continue
+		}
+		// Pack objects are expanded into their contents when packing
+		// is enabled
+		if f.opt.PackSmallFiles > 0 && isPackName(item.ObjectName) {
+			continue
+		}
+		o := f.newObjectWithInfo(path.Join(dir, f.opt.Enc.ToStandardPath(item.ObjectName)), item)
+		o.hasSidecar = sidecars[item.ObjectName]
+		objs = append(objs, o)
+	}
+	return objs
+}
+
+// Dirs returns the directory items of the listing rooted at dir
+func (l DirList) Dirs(f *Fs, dir string) (dirs []*fs.Dir) {
+	for i := range l {
+		item := &l[i]
+		if !item.IsDirectory {
+			continue
+		}
+		d := fs.NewDir(path.Join(dir, f.opt.Enc.ToStandardPath(item.ObjectName)), item.ModTime())
+		d.SetID(item.Guid)
+		dirs = append(dirs, d)
+	}
+	return dirs
+}
+
+// listCache caches directory listings for a short time to avoid
+// refetching a directory for every NewObject call during a sync.
+//
+// With list_cache_dir set entries are also persisted to disk so a
+// fresh process can reuse listings fetched by an earlier one within
+// the TTL.
+type listCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]listCacheEntry
+	dir     string // on-disk cache directory, "" for memory only
+	prefix  string // filename prefix identifying this zone and root
+}
+
+type listCacheEntry struct {
+	list DirList
+	at   time.Time
+}
+
+func newListCache(ttl time.Duration) *listCache {
+	return &listCache{
+		ttl:     ttl,
+		entries: map[string]listCacheEntry{},
+	}
+}
+
+// normalizeDirKey normalizes dir for use as a cache key so that
+// logically identical directories ("a", "a/", "./a") share an entry.
+//
+// Object keys are case sensitive on bunny so case is preserved.
+func normalizeDirKey(dir string) string {
+	dir = path.Clean("/" + dir)
+	return strings.TrimPrefix(dir, "/")
+}
+
+// setDisk enables on-disk persistence under dir, keying entries by
+// zone and root so remotes don't read each other's listings.
+func (c *listCache) setDisk(dir, zone, root string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(zone + "\x00" + root))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = dir
+	c.prefix = hex.EncodeToString(sum[:8])
+	return nil
+}
+
+// diskListEntry is the JSON shape of a persisted listing
+type diskListEntry struct {
+	At   time.Time `json:"at"`
+	List DirList   `json:"list"`
+}
+
+// fileName returns the on-disk path for the normalized dir key.
+// Must be called with the lock held.
+func (c *listCache) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, c.prefix+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// Get fetches a cached listing for dir, returning ok=false if absent or expired
+func (c *listCache) Get(dir string) (list DirList, ok bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeDirKey(dir)
+	entry, ok := c.entries[key]
+	if ok && time.Since(entry.at) <= c.ttl {
+		return entry.list, true
+	}
+	if c.dir == "" {
+		return nil, false
+	}
+	// Fall back to a listing persisted by an earlier process
+	data, err := os.ReadFile(c.fileName(key))
+	if err != nil {
+		return nil, false
+	}
+	var disk diskListEntry
+	if err := json.Unmarshal(data, &disk); err != nil || time.Since(disk.At) > c.ttl {
+		return nil, false
+	}
+	c.entries[key] = listCacheEntry{list: disk.List, at: disk.At}
+	return disk.List, true
+}
+
+// Put stores a listing for dir
+func (c *listCache) Put(dir string, list DirList) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeDirKey(dir)
+	now := time.Now()
+	c.entries[key] = listCacheEntry{list: list, at: now}
+	if c.dir != "" {
+		data, err := json.Marshal(diskListEntry{At: now, List: list})
+		if err == nil {
+			err = os.WriteFile(c.fileName(key), data, 0600)
+		}
+		if err != nil {
+			fs.Debugf(nil, "bunny: failed to persist listing cache entry: %v", err)
+		}
+	}
+}
+
+// Refresh patches a single entry of the cached listing for dir in
+// place: item replaces (or adds) the file entry named leaf and a nil
+// item removes it. The rest of the cached listing - and its timestamp
+// - are left alone, so one changed object doesn't throw the whole
+// directory away. A no-op when dir isn't cached.
+func (c *listCache) Refresh(dir, leaf string, item *api.DirItem) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeDirKey(dir)
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.at) > c.ttl {
+		return
+	}
+	list := make(DirList, 0, len(entry.list)+1)
+	for i := range entry.list {
+		if !entry.list[i].IsDirectory && entry.list[i].ObjectName == leaf {
+			continue
+		}
+		list = append(list, entry.list[i])
+	}
+	if item != nil {
+		list = append(list, *item)
+	}
+	c.entries[key] = listCacheEntry{list: list, at: entry.at}
+	if c.dir != "" {
+		data, err := json.Marshal(diskListEntry{At: entry.at, List: list})
+		if err == nil {
+			err = os.WriteFile(c.fileName(key), data, 0600)
+		}
+		if err != nil {
+			fs.Debugf(nil, "bunny: failed to persist listing cache entry: %v", err)
+		}
+	}
+}
+
+// Clear removes the cached listing for dir
+func (c *listCache) Clear(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeDirKey(dir)
+	delete(c.entries, key)
+	if c.dir != "" {
+		_ = os.Remove(c.fileName(key))
+	}
+}
+
+// ClearUnder removes the cached listings of dir and every directory
+// below it, for when a whole subtree is deleted at once. Disk cache
+// entries for subdirectories not currently in memory are left to
+// expire via the TTL.
+func (c *listCache) ClearUnder(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeDirKey(dir)
+	for k := range c.entries {
+		if k == key || key == "" || strings.HasPrefix(k, key+"/") {
+			delete(c.entries, k)
+			if c.dir != "" {
+				_ = os.Remove(c.fileName(k))
+			}
+		}
+	}
+	if c.dir != "" {
+		_ = os.Remove(c.fileName(key))
+	}
+}
+
+// ClearAll empties the cache
+func (c *listCache) ClearAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]listCacheEntry{}
+	if c.dir != "" {
+		matches, err := filepath.Glob(filepath.Join(c.dir, c.prefix+"-*.json"))
+		if err == nil {
+			for _, name := range matches {
+				_ = os.Remove(name)
+			}
+		}
+	}
+}
+
+// errCircuitOpen is returned for requests refused while the circuit
+// breaker is open.
+var errCircuitOpen = errors.New("circuit breaker open: too many connection failures, pausing requests")
+
+// circuitBreaker pauses requests after repeated connection level
+// failures so a down edge isn't hammered by every transfer.
+//
+// Once circuit_breaker_failures requests in a row have failed at the
+// connection level the breaker opens and requests fail immediately
+// with errCircuitOpen. After the cool-down a single probe request is
+// let through - if it succeeds the breaker closes, otherwise the
+// cool-down starts again.
+type circuitBreaker struct {
+	f         fs.Fs // for logging
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int       // consecutive connection failures
+	openUntil time.Time // zero while closed
+	probing   bool      // a probe is in flight after the cool-down
+}
+
+func newCircuitBreaker(f fs.Fs, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{f: f, threshold: threshold, cooldown: cooldown}
+}
+
+// allow returns errCircuitOpen if the request should not be issued
+func (cb *circuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.openUntil.IsZero() {
+		return nil
+	}
+	if time.Now().After(cb.openUntil) && !cb.probing {
+		// Cool-down over - let a single probe through
+		cb.probing = true
+		fs.Debugf(cb.f, "circuit breaker cool-down over, probing")
+		return nil
+	}
+	return errCircuitOpen
+}
+
+// record notes the outcome of a request which was allowed through
+func (cb *circuitBreaker) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if err == nil {
+		if !cb.openUntil.IsZero() {
+			fs.Infof(cb.f, "circuit breaker closed, resuming requests")
+		}
+		cb.failures = 0
+		cb.openUntil = time.Time{}
+		cb.probing = false
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// Cancellation isn't a connection failure
+		return
+	}
+	cb.failures++
+	cb.probing = false
+	if cb.failures >= cb.threshold {
+		if cb.openUntil.IsZero() {
+			fs.Infof(cb.f, "circuit breaker opened after %d consecutive connection failures, pausing requests for %v", cb.failures, cb.cooldown)
+		} else {
+			fs.Debugf(cb.f, "circuit breaker probe failed, pausing requests for another %v", cb.cooldown)
+		}
+		cb.openUntil = time.Now().Add(cb.cooldown)
+	}
+}
+
+// Metric describes one completed API request, as passed to the
+// metrics hook.
+type Metric struct {
+	Operation string        // "list", "upload", "download", "head" or "delete"
+	Duration  time.Duration // time to the response headers
+	Status    int           // HTTP status, 0 when the request failed
+	Bytes     int64         // body bytes sent or received, 0 when unknown
+}
+
+// SetMetricsHook registers fn to be called after every API request so
+// callers can export per-operation metrics to external monitoring.
+//
+// The hook is invoked on its own goroutine so it can't block
+// operations. Pass nil to remove the hook.
+func (f *Fs) SetMetricsHook(fn func(Metric)) {
+	f.metricsMu.Lock()
+	defer f.metricsMu.Unlock()
+	f.metricsHook = fn
+}
+
+// emitMetric hands m to the metrics hook if one is registered
+func (f *Fs) emitMetric(m Metric) {
+	f.metricsMu.Lock()
+	hook := f.metricsHook
+	f.metricsMu.Unlock()
+	if hook != nil {
+		go hook(m)
+	}
+}
+
+// operationName maps a request to the operation name reported in
+// metrics.
+func operationName(req *http.Request) string {
+	switch req.Method {
+	case "PUT":
+		return "upload"
+	case "DELETE":
+		return "delete"
+	case "HEAD":
+		return "head"
+	case "GET":
+		if strings.HasSuffix(req.URL.Path, "/") {
+			return "list"
+		}
+		return "download"
+	}
+	return strings.ToLower(req.Method)
+}
+
+// throttleRemainingThreshold is the X-RateLimit-Remaining budget at or
+// below which proactive_throttle starts slowing requests down.
+const throttleRemainingThreshold = 10
+
+// throttleTransport slows requests down when the zone reports a low
+// remaining rate-limit budget, staying under the limit instead of
+// running into 429s. Enabled by proactive_throttle.
+type throttleTransport struct {
+	rt http.RoundTripper
+	f  *Fs
+
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	delay := t.delay
+	t.mu.Unlock()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if resp != nil {
+		t.update(resp)
+	}
+	return resp, err
+}
+
+// update adjusts the inter-request delay from the rate-limit budget
+// the response reports, if any.
+func (t *throttleTransport) update(resp *http.Response) {
+	s := resp.Header.Get("X-RateLimit-Remaining")
+	if s == "" {
+		return
+	}
+	remaining, err := strconv.Atoi(s)
+	if err != nil {
+		return
+	}
+	delay := time.Duration(0)
+	if remaining <= throttleRemainingThreshold {
+		// The lower the budget, the harder we brake
+		delay = time.Duration(throttleRemainingThreshold-remaining+1) * 100 * time.Millisecond
+	}
+	t.mu.Lock()
+	changed := delay != t.delay
+	t.delay = delay
+	t.mu.Unlock()
+	if changed {
+		if delay > 0 {
+			fs.Debugf(t.f, "proactive_throttle: %d requests left in the rate-limit budget - delaying requests by %v", remaining, delay)
+		} else {
+			fs.Debugf(t.f, "proactive_throttle: rate-limit budget recovered - full speed")
+		}
+	}
+}
+
+// metricsTransport reports every request to the Fs metrics hook
+type metricsTransport struct {
+	rt http.RoundTripper
+	f  *Fs
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+	m := Metric{
+		Operation: operationName(req),
+		Duration:  time.Since(start),
+	}
+	if err == nil {
+		m.Status = resp.StatusCode
+		switch req.Method {
+		case "PUT":
+			if req.ContentLength > 0 {
+				m.Bytes = req.ContentLength
+			}
+		case "GET":
+			if resp.ContentLength > 0 {
+				m.Bytes = resp.ContentLength
+			}
+		}
+	}
+	t.f.emitMetric(m)
+	return resp, err
+}
+
+// breakerTransport wraps a RoundTripper with a circuitBreaker
+type breakerTransport struct {
+	rt http.RoundTripper
+	cb *circuitBreaker
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.cb.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := t.rt.RoundTrip(req)
+	t.cb.record(err)
+	return resp, err
+}
+
+// closeIdleConnections closes rt's idle connections if it supports
+// that, as *http.Transport does.
+func closeIdleConnections(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// CloseIdleConnections forwards to the wrapped transport
+func (t *throttleTransport) CloseIdleConnections() { closeIdleConnections(t.rt) }
+
+// CloseIdleConnections forwards to the wrapped transport
+func (t *metricsTransport) CloseIdleConnections() { closeIdleConnections(t.rt) }
+
+// CloseIdleConnections forwards to the wrapped transport
+func (t *breakerTransport) CloseIdleConnections() { closeIdleConnections(t.rt) }
+
+// maxZoneNameLength is the longest storage zone name bunny accepts
+const maxZoneNameLength = 64
+
+// validateZoneName checks that zone is a plausible bunny storage zone
+// name, so typos fail at construction with a clear message instead of
+// as confusing 404s on every request.
+//
+// Zone names are made of letters, digits and hyphens and can neither
+// start nor end with a hyphen.
+func validateZoneName(zone string) error {
+	if zone == "" {
+		return errors.New("storage_zone must be set")
+	}
+	if len(zone) > maxZoneNameLength {
+		return fmt.Errorf("invalid storage_zone %q: longer than %d characters", zone, maxZoneNameLength)
+	}
+	if zone[0] == '-' || zone[len(zone)-1] == '-' {
+		return fmt.Errorf("invalid storage_zone %q: can't start or end with a hyphen", zone)
+	}
+	for _, c := range zone {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9':
+		case c == '-':
+		default:
+			return fmt.Errorf("invalid storage_zone %q: character %q not allowed - zone names contain only letters, digits and hyphens", zone, c)
+		}
+	}
+	return nil
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateZoneName(opt.StorageZone); err != nil {
+		return nil, err
+	}
+	opt.StripPrefix = strings.Trim(opt.StripPrefix, "/")
+
+	root = strings.Trim(root, "/")
+
+	endpoint, err := resolveEndpoint(opt.StorageEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fs{
+		name:     name,
+		root:     root,
+		opt:      *opt,
+		endpoint: endpoint,
+	}
+	f.retryableCodes, err = parseRetryableCodes(opt.RetryableCodes)
+	if err != nil {
+		return nil, err
+	}
+	if opt.DownloadViaCDN && opt.PullZoneHostname == "" {
+		return nil, errors.New("download_via_cdn requires pull_zone_hostname to be set")
+	}
+	// Fall back to the defaults for unset pacer knobs - NewFs may be
+	// called with a bare config map which never saw the registry
+	// defaults
+	pacerMin := time.Duration(opt.PacerMinSleep)
+	if pacerMin <= 0 {
+		pacerMin = minSleep
+	}
+	pacerMax := time.Duration(opt.PacerMaxSleep)
+	if pacerMax <= 0 {
+		pacerMax = maxSleep
+	}
+	if pacerMin > pacerMax {
+		return nil, fmt.Errorf("pacer_min_sleep %v must not exceed pacer_max_sleep %v", pacerMin, pacerMax)
+	}
+	pacerDecay := opt.PacerDecayConstant
+	if pacerDecay <= 0 {
+		pacerDecay = decayConstant
+	}
+	f.pacer = fs.NewPacer(ctx, pacer.NewDefault(pacer.MinSleep(pacerMin), pacer.MaxSleep(pacerMax), pacer.DecayConstant(uint(pacerDecay))))
+	f.cache = newListCache(time.Duration(opt.ListCacheTime))
+	if opt.ListConcurrency > 0 {
+		f.listSem = make(chan struct{}, opt.ListConcurrency)
+	}
+	if opt.ListCacheDir != "" {
+		if err := f.cache.setDisk(opt.ListCacheDir, opt.StorageZone, root); err != nil {
+			return nil, fmt.Errorf("failed to initialise list_cache_dir: %w", err)
+		}
+	}
+	if opt.ChecksumManifest != "" {
+		if err := f.loadChecksumManifest(opt.ChecksumManifest); err != nil {
+			return nil, fmt.Errorf("failed to load checksum_manifest: %w", err)
+		}
+	}
+	f.checkpoint, err = openCopyCheckpoint(opt.CopyCheckpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open copy_checkpoint: %w", err)
+	}
+
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		ReadMetadata:            true,
+		WriteMetadata:           true,
+		UserMetadata:            true,
+	}).Fill(ctx, f)
+
+	if opt.UserAgent != "" {
+		// fshttp forces the user agent at the transport, so override
+		// it there rather than on individual requests
+		var ci *fs.ConfigInfo
+		ctx, ci = fs.AddConfig(ctx)
+		ci.UserAgent = opt.UserAgent
+	}
+	f.httpClient = fshttp.NewClient(ctx)
+	if opt.MaxIdleConns > 0 || opt.IdleConnTimeout > 0 || opt.UserAgent != "" {
+		// Build a dedicated transport - the global one is shared with
+		// other remotes and can't carry per remote connection pool
+		// settings or a custom user agent.
+		f.httpClient.Transport = fshttp.NewTransportCustom(ctx, func(t *http.Transport) {
+			if opt.MaxIdleConns > 0 {
+				t.MaxIdleConns = opt.MaxIdleConns
+				t.MaxIdleConnsPerHost = opt.MaxIdleConns
+			}
+			if opt.IdleConnTimeout > 0 {
+				t.IdleConnTimeout = time.Duration(opt.IdleConnTimeout)
+			}
+		})
+	}
+	if opt.ProactiveThrottle {
+		f.httpClient.Transport = &throttleTransport{rt: f.httpClient.Transport, f: f}
+	}
+	var breaker *circuitBreaker
+	if opt.CircuitBreakerFailures > 0 {
+		breaker = newCircuitBreaker(f, opt.CircuitBreakerFailures, time.Duration(opt.CircuitBreakerCooldown))
+		f.httpClient.Transport = &breakerTransport{rt: f.httpClient.Transport, cb: breaker}
+	}
+	f.httpClient.Transport = &metricsTransport{rt: f.httpClient.Transport, f: f}
+	f.readClient = f.httpClient
+	if opt.HTTPCacheProxy != "" {
+		proxyURL, err := url.Parse(opt.HTTPCacheProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http_cache_proxy: %w", err)
+		}
+		var proxyTransport http.RoundTripper = fshttp.NewTransportCustom(ctx, func(t *http.Transport) {
+			t.Proxy = http.ProxyURL(proxyURL)
+		})
+		if breaker != nil {
+			proxyTransport = &breakerTransport{rt: proxyTransport, cb: breaker}
+		}
+		proxyTransport = &metricsTransport{rt: proxyTransport, f: f}
+		f.readClient = &http.Client{Transport: proxyTransport}
+	}
+	f.srv = rest.NewClient(f.httpClient)
+	f.srv.SetRoot(f.endpoint)
+	f.srv.SetHeader("AccessKey", opt.AccessKey)
+	f.srv.SetErrorHandler(errorHandler)
+
+	if opt.APIKey != "" {
+		f.mgmt = rest.NewClient(f.httpClient)
+		f.mgmt.SetRoot(mgmtURL)
+		f.mgmt.SetHeader("AccessKey", opt.APIKey)
+		f.mgmt.SetErrorHandler(errorHandler)
+	}
+
+	if opt.AutoRegion {
+		f.selectRegion(ctx)
+	}
+
+	if f.root != "" {
+		// Check whether the root points at an existing file. If so hand
+		// back an Fs rooted on the parent with fs.ErrorIsFile so
+		// commands operate on the single file, like other backends do.
+		oldRoot := f.root
+		parent, leaf := path.Split(oldRoot)
+		f.root = strings.Trim(parent, "/")
+		// The cache keys listings relative to the root, so anything it
+		// holds or fetches while the root is temporarily the parent
+		// would be filed under the wrong directory - give the probe a
+		// throwaway cache and leave the real one (and any listings
+		// persisted by earlier runs) untouched
+		rootedCache := f.cache
+		f.cache = newListCache(time.Duration(opt.ListCacheTime))
+		_, err := f.NewObject(ctx, leaf)
+		f.cache = rootedCache
+		if err != nil {
+			if err == fs.ErrorObjectNotFound || err == fs.ErrorIsDir {
+				// Not a file - keep the root as configured
+				f.root = oldRoot
+				return f, nil
+			}
+			return nil, err
+		}
+		return f, fs.ErrorIsFile
+	}
+
+	return f, nil
+}
+
+// autoRegionEndpoints lists the endpoints auto_region probes. A
+// variable so tests can point it at stub servers.
+var autoRegionEndpoints = []string{
+	endpointURL,
+	"https://ny.storage.bunnycdn.com",
+	"https://la.storage.bunnycdn.com",
+	"https://sg.storage.bunnycdn.com",
+	"https://syd.storage.bunnycdn.com",
+	"https://uk.storage.bunnycdn.com",
+	"https://se.storage.bunnycdn.com",
+	"https://br.storage.bunnycdn.com",
+}
+
+// autoRegionCache remembers the endpoint auto_region picked for each
+// storage zone so repeated uses of a remote don't re-probe.
+var (
+	autoRegionMu    sync.Mutex
+	autoRegionCache = map[string]string{}
+)
+
+// selectRegion probes the candidate regional endpoints and points the
+// Fs at the fastest one serving the zone, keeping the configured
+// endpoint when no probe succeeds.
+func (f *Fs) selectRegion(ctx context.Context) {
+	autoRegionMu.Lock()
+	cached, ok := autoRegionCache[f.opt.StorageZone]
+	autoRegionMu.Unlock()
+	if ok {
+		f.setEndpoint(cached)
+		return
+	}
+	best := ""
+	var bestMillis float64
+	for _, endpoint := range autoRegionEndpoints {
+		res := f.probeEndpoint(ctx, endpoint)
+		if res.Status != "ok" {
+			// The zone isn't served from this region (or it's down)
+			fs.Debugf(f, "auto_region: skipping %s: %s", endpoint, res.Status)
+			continue
+		}
+		if best == "" || res.Millis < bestMillis {
+			best, bestMillis = endpoint, res.Millis
+		}
+	}
+	if best == "" {
+		fs.Logf(f, "auto_region: no regional endpoint answered - staying on %s", f.endpoint)
+		return
+	}
+	fs.Debugf(f, "auto_region: selected %s (%.1fms)", best, bestMillis)
+	autoRegionMu.Lock()
+	autoRegionCache[f.opt.StorageZone] = best
+	autoRegionMu.Unlock()
+	f.setEndpoint(best)
+}
+
+// resolveEndpoint maps the storage_endpoint option to the endpoint to
+// use: empty keeps the main DE endpoint, a full URL is used verbatim,
+// and a friendly region code like "ny" becomes the matching regional
+// hostname.
+func resolveEndpoint(value string) (string, error) {
+	if value == "" {
+		return endpointURL, nil
+	}
+	if strings.Contains(value, "://") {
+		return strings.TrimSuffix(value, "/"), nil
+	}
+	code := strings.ToLower(value)
+	for _, r := range code {
+		if r < 'a' || r > 'z' {
+			return "", fmt.Errorf("invalid storage_endpoint %q: must be a region code like \"ny\" or a full URL", value)
+		}
+	}
+	if code == "de" {
+		// The primary region has no host prefix
+		return endpointURL, nil
+	}
+	return "https://" + code + ".storage.bunnycdn.com", nil
+}
+
+// region returns the storage region the configured endpoint serves
+// from, derived from the endpoint hostname. Regional endpoints are
+// named like ny.storage.bunnycdn.com; the bare endpoint is the
+// primary DE (Falkenstein) region.
+func (f *Fs) region() string {
+	host := f.endpoint
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	if i := strings.IndexAny(host, "/:"); i >= 0 {
+		host = host[:i]
+	}
+	const base = ".storage.bunnycdn.com"
+	if strings.HasSuffix(host, base) {
+		return strings.ToUpper(strings.TrimSuffix(host, base))
+	}
+	return "DE"
+}
+
+// setEndpoint points the Fs at a different storage endpoint
+func (f *Fs) setEndpoint(endpoint string) {
+	f.endpoint = strings.TrimSuffix(endpoint, "/")
+	f.srv.SetRoot(f.endpoint)
+}
+
+// errorHandler parses a non 2xx error response into an error
+func errorHandler(resp *http.Response) error {
+	body, err := rest.ReadBody(resp)
+	if err != nil {
+		return fmt.Errorf("error when trying to read error body: %w", err)
+	}
+	// Decode error response
+	errResponse := new(api.Error)
+	err = json.Unmarshal(body, errResponse)
+	if err != nil {
+		// Set the Message to be the body if we can't parse the JSON
+		errResponse.Message = strings.TrimSpace(string(body))
+	}
+	errResponse.Status = resp.Status
+	if errResponse.HTTPCode == 0 {
+		errResponse.HTTPCode = resp.StatusCode
+	}
+	return errResponse
+}
+
+// parseRetryableCodes parses a comma separated list of bunny error
+// codes into a set.
+func parseRetryableCodes(s string) (map[int]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	codes := map[int]bool{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retryable_codes entry %q: %w", field, err)
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
+
+// parseRetryAfter reads the Retry-After header of resp, in either its
+// delay-seconds or HTTP-date form, returning ok=false when absent or
+// unparseable.
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// shouldRetry returns a boolean as to whether this resp and err
+// deserve to be retried.  It returns the err as a convenience
+func (f *Fs) shouldRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if fserrors.ContextError(ctx, &err) {
+		return false, err
+	}
+	if resp != nil {
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			// Honor the delay the server asked for, fall back to the
+			// fixed delay for rate limits and let the pacer's
+			// exponential backoff govern the rest
+			if delay, ok := parseRetryAfter(resp); ok {
+				return true, pacer.RetryAfterError(err, delay)
+			}
+			if resp.StatusCode == http.StatusTooManyRequests {
+				return true, pacer.RetryAfterError(err, retryAfter)
+			}
+			return true, err
+		}
+	}
+	// The error code in the body is more precise than the HTTP status
+	apiErr := new(api.Error)
+	if errors.As(err, &apiErr) && f.retryableCodes[apiErr.ErrorCode] {
+		return true, err
+	}
+	return fserrors.ShouldRetry(err), err
+}
+
+// drainAndClose discards and closes a response body that is about to
+// be retried so the underlying connection can be reused
+func drainAndClose(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
+
+// doWithPacer sends req through client governed by the pacer,
+// retrying retryable statuses and draining their bodies so the
+// connections are reused. A request whose body can't be replayed
+// (req.GetBody unset) is not retried.
+func (f *Fs) doWithPacer(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	err := f.pacer.Call(func() (bool, error) {
+		var reqErr error
+		resp, reqErr = client.Do(req)
+		retry, retryErr := f.shouldRetry(ctx, resp, reqErr)
+		if !retry {
+			return false, retryErr
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				// A streaming body is gone - leave the retry to the
+				// higher levels
+				if retryErr != nil {
+					drainAndClose(resp)
+				}
+				return false, retryErr
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				drainAndClose(resp)
+				return false, retryErr
+			}
+			req.Body = body
+		}
+		drainAndClose(resp)
+		return true, retryErr
+	})
+	return resp, err
+}
+
+// getFullFilePath returns the path of remote on the storage endpoint
+// including the storage zone but excluding the endpoint itself.
+//
+// With strip_prefix set the prefix is inserted between the root and
+// the remote name here, so listings come back relative to it and
+// every operation targets the full stored path.
+//
+// Trailing dots in path segments are passed through unchanged - they
+// survive URL escaping and the storage API stores them verbatim. Use
+// strict_names to reject them instead.
+func (f *Fs) getFullFilePath(remote string) string {
+	return rest.URLPathEscape(f.storedPath(remote))
+}
+
+// storedPath returns the raw stored path of remote without URL
+// escaping, the form the API reports in listing Path fields
+func (f *Fs) storedPath(remote string) string {
+	return path.Join(f.opt.StorageZone,
+		f.opt.Enc.FromStandardPath(path.Join(f.root, f.opt.StripPrefix, f.transliterate(remote))))
+}
+
+// transliterate maps remote to the name the object is stored under
+// when the transliterate option is set, replacing characters bunny
+// can't store with "_". The path structure is preserved.
+func (f *Fs) transliterate(remote string) string {
+	if !f.opt.Transliterate {
+		return remote
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || (r >= 0x20 && r < 0x7f) {
+			return r
+		}
+		return '_'
+	}, remote)
+}
+
+// checkRemoteName validates remote against the strict_names option
+func (f *Fs) checkRemoteName(remote string) error {
+	if !f.opt.StrictNames {
+		return nil
+	}
+	for _, segment := range strings.Split(path.Join(f.root, remote), "/") {
+		if segment != "" && segment != "." && strings.HasSuffix(segment, ".") {
+			return fmt.Errorf("path segment %q has a trailing dot which is rejected by strict_names", segment)
+		}
+	}
+	return nil
+}
+
+// dirPath returns the listing path for dir with a trailing slash
+func (f *Fs) dirPath(dir string) string {
+	return f.getFullFilePath(dir) + "/"
+}
+
+// newRequest makes an authenticated request to the storage endpoint
+func (f *Fs) newRequest(ctx context.Context, method, fullPath string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, f.endpoint+"/"+fullPath, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("AccessKey", f.opt.AccessKey)
+	return req, nil
+}
+
+// errStorageFull is returned when the zone rejects an upload with 507
+// Insufficient Storage. It is marked fatal so it is not retried and
+// scripts get a distinct error to catch.
+var errStorageFull = fserrors.FatalError(errors.New("storage zone full: upload rejected with 507 Insufficient Storage"))
+
+// uploadStatusErr converts a failed upload response into an error,
+// mapping 507 to the distinct errStorageFull.
+func uploadStatusErr(resp *http.Response) error {
+	if resp.StatusCode == http.StatusInsufficientStorage {
+		_ = resp.Body.Close()
+		return errStorageFull
+	}
+	return readError(resp)
+}
+
+// readError reads and parses the error from an unsuccessful response,
+// closing the body.
+func readError(resp *http.Response) *api.Error {
+	err := errorHandler(resp)
+	apiErr, ok := err.(*api.Error)
+	if !ok {
+		apiErr = &api.Error{
+			Status:   resp.Status,
+			HTTPCode: resp.StatusCode,
+			Message:  err.Error(),
+		}
+	}
+	return apiErr
+}
+
+// isReadOnlyError reports whether the error indicates the object is
+// marked read-only on the zone.
+func isReadOnlyError(apiErr *api.Error) bool {
+	if apiErr == nil {
+		return false
+	}
+	if apiErr.HTTPCode != http.StatusForbidden {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Message)
+	return strings.Contains(msg, "read-only") || strings.Contains(msg, "read only") || strings.Contains(msg, "readonly")
+}
+
+// clearReadOnly clears the read-only flag on remote via the management API
+func (f *Fs) clearReadOnly(ctx context.Context, remote string) error {
+	if f.mgmt == nil {
+		return errors.New("clearing the read-only flag requires api_key to be set")
+	}
+	opts := rest.Opts{
+		Method:     "POST",
+		Path:       "/storagezone/" + f.opt.StorageZone + "/files/" + rest.URLPathEscape(path.Join(f.root, f.opt.StripPrefix, remote)) + "/read-only",
+		NoResponse: true,
+	}
+	request := struct {
+		ReadOnly bool `json:"ReadOnly"`
+	}{ReadOnly: false}
+	err := f.pacer.Call(func() (bool, error) {
+		resp, err := f.mgmt.CallJSON(ctx, &opts, &request, nil)
+		return f.shouldRetry(ctx, resp, err)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear read-only flag: %w", err)
+	}
+	return nil
+}
+
+// decodeListing decodes a JSON array of listing entries from r one
+// element at a time, so a huge directory doesn't need the raw
+// response body buffered in memory alongside the decoded entries. A
+// truncated or corrupt body surfaces as a decode error - the decoder
+// never returns a partial listing as a good one.
+func decodeListing(r io.Reader) (DirList, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		// A JSON null, which json.Unmarshal also accepts as an empty listing
+		return nil, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected a JSON array, got %v", tok)
+	}
+	var list DirList
+	for dec.More() {
+		var item api.DirItem
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	// Consume the closing bracket - its absence means truncation
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// list fetches the listing of dir, using the cache if possible
+func (f *Fs) list(ctx context.Context, dir string) (list DirList, err error) {
+	if cached, ok := f.cache.Get(dir); ok {
+		return cached, nil
+	}
+	if f.listSem != nil {
+		select {
+		case f.listSem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		defer func() { <-f.listSem }()
+	}
+	ctx, cancel := f.metadataCtx(ctx)
+	defer cancel()
+	opts := rest.Opts{
+		Method: "GET",
+		Path:   "/" + f.dirPath(dir),
+	}
+	fetch := func() (DirList, error) {
+		var list DirList
+		var resp *http.Response
+		err := f.pacer.Call(func() (bool, error) {
+			list = nil
+			resp, err = f.srv.Call(ctx, &opts)
+			if err != nil {
+				return f.shouldRetry(ctx, resp, err)
+			}
+			list, err = decodeListing(resp.Body)
+			if closeErr := resp.Body.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				// A decode error means a truncated or corrupt response -
+				// never return a partial listing, re-fetch instead
+				err = fmt.Errorf("couldn't decode listing of %q: %w", dir, err)
+				fs.Debugf(f, "%v - retrying", err)
+				return true, err
+			}
+			return false, nil
+		})
+		if err != nil {
+			if apiErr, ok := err.(*api.Error); ok && apiErr.HTTPCode == http.StatusNotFound {
+				return nil, fs.ErrorDirNotFound
+			}
+			return nil, err
+		}
+		return list, nil
+	}
+	list, err = fetch()
+	// The zone is eventually consistent, so a listing right after an
+	// upload can come back without the new object (or 404 when the
+	// upload created the directory). With list_retry_on_empty set,
+	// re-fetch a few times before believing such a listing.
+	if f.opt.ListRetryOnEmpty > 0 && (err == nil || err == fs.ErrorDirNotFound) {
+		delay := 100 * time.Millisecond
+		for attempt := 0; attempt < f.opt.ListRetryOnEmpty; attempt++ {
+			missing := f.missingRecentWrites(dir, list)
+			if len(missing) == 0 {
+				break
+			}
+			fs.Debugf(f, "listing of %q is missing recently written %v - retrying in %v (list_retry_on_empty)", dir, missing, delay)
+			time.Sleep(delay)
+			delay *= 2
+			list, err = fetch()
+			if err != nil && err != fs.ErrorDirNotFound {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Guard against API quirks: an entry whose Path says it lives
+	// somewhere other than the directory we asked for would surface
+	// under the wrong name, so drop it rather than trust it. Path
+	// holds the raw stored path, so compare unescaped.
+	expectedPath := "/" + f.storedPath(dir) + "/"
+	keep := list[:0]
+	for i := range list {
+		if list[i].Path != "" && list[i].Path != expectedPath {
+			fs.Logf(f, "listing of %q contained entry %q with path %q instead of %q - ignoring it", dir, list[i].ObjectName, list[i].Path, expectedPath)
+			continue
+		}
+		keep = append(keep, list[i])
+	}
+	list = keep
+	if f.opt.LargeDirThreshold > 0 && len(list) >= f.opt.LargeDirThreshold {
+		f.warnLargeDir(dir, len(list))
+	}
+	f.cache.Put(dir, list)
+	return list, nil
+}
+
+// recentWriteWindow is how long a completed upload counts as "recent"
+// for the list_retry_on_empty option.
+const recentWriteWindow = time.Minute
+
+// recordRecentWrite notes a completed upload so listings which should
+// contain it can be retried. A no-op unless list_retry_on_empty is set.
+func (f *Fs) recordRecentWrite(remote string) {
+	if f.opt.ListRetryOnEmpty <= 0 {
+		return
+	}
+	f.recentMu.Lock()
+	defer f.recentMu.Unlock()
+	if f.recentWrites == nil {
+		f.recentWrites = map[string]time.Time{}
+	}
+	f.recentWrites[f.transliterate(remote)] = time.Now()
+}
+
+// missingRecentWrites returns the names of recently written objects in
+// dir which list doesn't contain, pruning writes older than
+// recentWriteWindow as it goes.
+func (f *Fs) missingRecentWrites(dir string, list DirList) (missing []string) {
+	f.recentMu.Lock()
+	defer f.recentMu.Unlock()
+	for remote, at := range f.recentWrites {
+		if time.Since(at) > recentWriteWindow {
+			delete(f.recentWrites, remote)
+			continue
+		}
+		parent := path.Dir(remote)
+		if parent == "." {
+			parent = ""
+		}
+		if parent != dir {
+			continue
+		}
+		leaf := f.opt.Enc.FromStandardName(path.Base(remote))
+		found := false
+		for i := range list {
+			if !list[i].IsDirectory && list[i].ObjectName == leaf {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, leaf)
+		}
+	}
+	return missing
+}
+
+// warnLargeDir logs a warning the first time a directory's listing
+// reaches large_dir_threshold entries.
+func (f *Fs) warnLargeDir(dir string, n int) {
+	f.largeDirMu.Lock()
+	defer f.largeDirMu.Unlock()
+	if f.largeDirWarned[dir] {
+		return
+	}
+	if f.largeDirWarned == nil {
+		f.largeDirWarned = make(map[string]bool)
+	}
+	f.largeDirWarned[dir] = true
+	fs.Logf(f, "directory %q has %d entries which must be held in memory to list - consider splitting it up or listing narrower prefixes (warning threshold large_dir_threshold=%d)", dir, n, f.opt.LargeDirThreshold)
+}
+
+// clearDirCache invalidates the cached listing of the parent directory
+// of remote after a modification.
+func (f *Fs) clearDirCache(remote string) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	f.cache.Clear(dir)
+}
+
+// refreshCacheEntry re-fetches remote's metadata with a HEAD request
+// and patches just its entry in the cached listing of its directory,
+// keeping the other cached entries valid instead of invalidating the
+// whole directory.
+func (f *Fs) refreshCacheEntry(ctx context.Context, remote string) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	if _, ok := f.cache.Get(dir); !ok {
+		return // nothing cached to keep coherent
+	}
+	leaf := f.opt.Enc.FromStandardName(path.Base(f.transliterate(remote)))
+	resp, err := f.headObject(ctx, remote)
+	if err == fs.ErrorObjectNotFound {
+		f.cache.Refresh(dir, leaf, nil)
+		return
+	}
+	if err != nil {
+		// Can't refresh the one entry - fall back to invalidating the
+		// directory
+		f.cache.Clear(dir)
+		return
+	}
+	item := &api.DirItem{
+		// The listing API reports Path unescaped - a synthesized entry
+		// must match or anything comparing paths sees a phantom rename
+		Path:        "/" + f.storedPath(dir) + "/",
+		ObjectName:  leaf,
+		Length:      resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		Checksum:    strings.ToUpper(resp.Header.Get("Checksum")),
+	}
+	if t, timeErr := http.ParseTime(resp.Header.Get("Last-Modified")); timeErr == nil {
+		// Same layout the listing API uses for LastChanged
+		item.LastChanged = t.UTC().Format("2006-01-02T15:04:05.999")
+	}
+	if mt := resp.Header.Get(mtimeHeader); mt != "" {
+		// The upload recorded its source modtime - prefer it over
+		// when the object changed on the zone
+		if t, parseErr := time.Parse(time.RFC3339Nano, mt); parseErr == nil {
+			item.LastChanged = t.UTC().Format("2006-01-02T15:04:05.999")
+		}
+	}
+	f.cache.Refresh(dir, leaf, item)
+}
+
+// dropCacheEntry removes a single entry from the cached listing of
+// remote's directory, for when the object is known to be gone.
+func (f *Fs) dropCacheEntry(remote string) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	f.cache.Refresh(dir, f.opt.Enc.FromStandardName(path.Base(f.transliterate(remote))), nil)
+}
+
+// newObjectWithInfo creates an Object from a listing entry
+func (f *Fs) newObjectWithInfo(remote string, item *api.DirItem) *Object {
+	sum := strings.ToLower(item.Checksum)
+	if sum != "" && !isSHA256Hex(sum) {
+		// A truncated or mangled checksum stored as-is would cause
+		// false mismatches on every verification, so drop it.
+		fs.Logf(f, "object %q has an implausible checksum %q in the listing - treating its checksum as unavailable", remote, item.Checksum)
+		sum = ""
+	}
+	o := &Object{
+		fs:              f,
+		remote:          remote,
+		size:            item.Length,
+		modTime:         item.ModTime(),
+		sha256:          sum,
+		contentType:     item.ContentType,
+		id:              item.Guid,
+		replicatedZones: item.ReplicatedZones,
+	}
+	if f.opt.ExposeRawMetadata {
+		// Copy the entry so the object doesn't pin the cached listing
+		raw := *item
+		o.raw = &raw
+	}
+	f.applyModtimePolicies(remote, o)
+	return o
+}
+
+// applyModtimePolicies applies missing_modtime_policy and
+// future_modtime_policy to o's freshly parsed timestamp.
+func (f *Fs) applyModtimePolicies(remote string, o *Object) {
+	if o.modTime.IsZero() {
+		// The timestamp didn't parse - apply missing_modtime_policy
+		o.modTimeMissing = true
+		if f.opt.MissingModtime == "now" {
+			o.modTime = time.Now()
+		}
+	} else if o.modTime.After(time.Now().Add(futureModTimeSlack)) {
+		// Clock skew or a bad upload dated the object in the future -
+		// apply future_modtime_policy
+		switch f.opt.FutureModtime {
+		case "clamp":
+			fs.Debugf(f, "object %q has timestamp %v in the future - clamping to now (future_modtime_policy)", remote, o.modTime)
+			o.modTime = time.Now()
+		case "warn":
+			fs.Logf(f, "object %q has timestamp %v which is implausibly far in the future", remote, o.modTime)
+		}
+	}
+}
+
+// isSHA256Hex reports whether s looks like a lower case hex encoded
+// SHA256 - 64 hex digits.
+func isSHA256Hex(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+		case c >= 'a' && c <= 'f':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("bunny storage zone %s path %s", f.opt.StorageZone, f.root)
+}
+
+// Precision of the remote which is the smallest modtime difference
+// that can be stored
+//
+// Uploads record their source modification time in the mtime header
+// to millisecond precision; objects uploaded by other means fall back
+// to bunny's own LastChanged timestamp.
+func (f *Fs) Precision() time.Duration {
+	return time.Millisecond
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	if f.opt.DisableChecksum {
+		return hash.Set(hash.None)
+	}
+	return hash.Set(hash.SHA256)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	list, err := f.list(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	seenDirs := map[string]bool{}
+	for _, d := range list.Dirs(f, dir) {
+		seenDirs[d.Remote()] = true
+		entries = append(entries, d)
+	}
+	for _, o := range list.Files(f, dir) {
+		// ObjectName should always be a leaf name, but if one ever
+		// arrives with embedded slashes the object lives deeper in
+		// the tree - synthesize the intermediate directories so the
+		// nested path hangs off the listing properly
+		for parent := path.Dir(o.remote); parent != dir && parent != "." && parent != "/"; parent = path.Dir(parent) {
+			if !seenDirs[parent] {
+				seenDirs[parent] = true
+				entries = append(entries, fs.NewDir(parent, time.Time{}))
+			}
+		}
+		entries = append(entries, o)
+	}
+	if f.opt.PackSmallFiles > 0 {
+		packed, err := f.packEntries(ctx, dir, list)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range packed {
+			entries = append(entries, o)
+		}
+	}
+	return entries, nil
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// Objects have their system metadata populated from the listing
+// responses so a metadata enabled recursive listing only spends a per
+// object request on the user metadata, which listings can't carry.
+func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) error {
+	helper := walk.NewListRHelper(callback)
+	var helperMu sync.Mutex // helper.Add isn't safe for concurrent use
+	// Track visited directories by path and by Guid so a cyclic
+	// reference in the listings can't recurse forever
+	var visitedMu sync.Mutex
+	visited := map[string]bool{
+		"path:" + normalizeDirKey(dir): true,
+	}
+	// Bunny lists one directory per request, so fan the walk out
+	// across --checkers workers. Subdirectories are walked inline
+	// when all workers are busy, which bounds the concurrency
+	// without deadlocking the group on itself.
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	var walkDir func(dir string) error
+	walkDir = func(dir string) error {
+		entries, err := f.List(gCtx, dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if o, ok := entry.(*Object); ok {
+				o.metaComplete = true
+			}
+			helperMu.Lock()
+			err := helper.Add(entry)
+			helperMu.Unlock()
+			if err != nil {
+				return err
+			}
+			if d, ok := entry.(fs.Directory); ok {
+				pathKey := "path:" + normalizeDirKey(d.Remote())
+				idKey := ""
+				if id := d.ID(); id != "" {
+					idKey = "id:" + id
+				}
+				visitedMu.Lock()
+				seen := visited[pathKey] || (idKey != "" && visited[idKey])
+				if !seen {
+					visited[pathKey] = true
+					if idKey != "" {
+						visited[idKey] = true
+					}
+				}
+				visitedMu.Unlock()
+				if seen {
+					fs.Logf(f, "ListR: skipping already visited directory %q - cyclic reference in listings", d.Remote())
+					continue
+				}
+				subDir := d.Remote()
+				if !g.TryGo(func() error { return walkDir(subDir) }) {
+					if err := walkDir(subDir); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	g.Go(func() error { return walkDir(dir) })
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return helper.Flush()
+}
+
+// rangeProbe checks whether remote exists with a single-byte ranged
+// GET, building the Object from the response headers.
+//
+// It returns errProbeAmbiguous if the response can't be interpreted,
+// or if the name might resolve to a directory or a packed small file,
+// in which case the caller should fall back to a listing.
+func (f *Fs) rangeProbe(ctx context.Context, remote string) (*Object, error) {
+	req, err := f.newRequest(ctx, "GET", f.getFullFilePath(remote), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := f.doWithPacer(ctx, f.readClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	o := &Object{
+		fs:          f,
+		remote:      remote,
+		size:        -1,
+		sha256:      f.probeChecksum(remote, resp),
+		contentType: resp.Header.Get("Content-Type"),
+	}
+	if t, timeErr := http.ParseTime(resp.Header.Get("Last-Modified")); timeErr == nil {
+		o.modTime = t
+	}
+	if mt := resp.Header.Get(mtimeHeader); mt != "" {
+		if t, parseErr := time.Parse(time.RFC3339Nano, mt); parseErr == nil {
+			o.modTime = t
+		}
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Size comes from the Content-Range total
+		total, ok := parseContentRangeTotal(resp.Header.Get("Content-Range"))
+		if !ok {
+			return nil, errProbeAmbiguous
+		}
+		o.size = total
+	case http.StatusOK:
+		// Server ignored the range - the whole (small) body is the object
+		o.size = resp.ContentLength
+		if o.size < 0 {
+			return nil, errProbeAmbiguous
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Exists but is empty
+		o.size = 0
+	case http.StatusNotFound:
+		// The name may still be a directory or a file held in an
+		// unflushed pack - let the listing lookup decide
+		return nil, errProbeAmbiguous
+	default:
+		return nil, errProbeAmbiguous
+	}
+	f.applyModtimePolicies(remote, o)
+	if o.modTimeMissing && f.opt.MissingModtime == "error" {
+		return nil, fmt.Errorf("object %q has an unparseable timestamp", remote)
+	}
+	o.probed = true
+	return o, nil
+}
+
+// probeChecksum returns the Checksum header of a probe response lower
+// cased, dropping implausible values the same way listings do.
+func (f *Fs) probeChecksum(remote string, resp *http.Response) string {
+	sum := strings.ToLower(resp.Header.Get("Checksum"))
+	if sum != "" && !isSHA256Hex(sum) {
+		fs.Logf(f, "object %q has an implausible checksum %q in the probe response - treating its checksum as unavailable", remote, resp.Header.Get("Checksum"))
+		sum = ""
+	}
+	return sum
+}
+
+// errProbeAmbiguous means a probe couldn't determine existence
+var errProbeAmbiguous = errors.New("probe was ambiguous")
+
+// headProbe checks whether remote exists with a single HEAD request,
+// building the Object from the response headers.
+//
+// It returns errProbeAmbiguous if the response can't fully describe
+// the object, or if the name might resolve to a directory or a packed
+// small file, in which case the caller should fall back to a listing.
+func (f *Fs) headProbe(ctx context.Context, remote string) (*Object, error) {
+	resp, err := f.headObject(ctx, remote)
+	if err == fs.ErrorObjectNotFound {
+		// The name may still be a directory or a file held in an
+		// unflushed pack - let the listing lookup decide
+		return nil, errProbeAmbiguous
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength < 0 {
+		return nil, errProbeAmbiguous
+	}
+	o := &Object{
+		fs:          f,
+		remote:      remote,
+		size:        resp.ContentLength,
+		sha256:      f.probeChecksum(remote, resp),
+		contentType: resp.Header.Get("Content-Type"),
+	}
+	if t, timeErr := http.ParseTime(resp.Header.Get("Last-Modified")); timeErr == nil {
+		o.modTime = t
+	}
+	if mt := resp.Header.Get(mtimeHeader); mt != "" {
+		if t, parseErr := time.Parse(time.RFC3339Nano, mt); parseErr == nil {
+			o.modTime = t
+		}
+	}
+	f.applyModtimePolicies(remote, o)
+	if o.modTimeMissing && f.opt.MissingModtime == "error" {
+		return nil, fmt.Errorf("object %q has an unparseable timestamp", remote)
+	}
+	o.probed = true
+	return o, nil
+}
+
+// parseContentRangeTotal extracts the total size from a Content-Range
+// header like "bytes 0-0/12345".
+func parseContentRangeTotal(contentRange string) (int64, bool) {
+	idx := strings.LastIndex(contentRange, "/")
+	if idx < 0 {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(contentRange[idx+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return total, true
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if f.useProbe(remote) {
+		probe := f.headProbe
+		if f.opt.ProbeMode == "range" {
+			probe = f.rangeProbe
+		}
+		o, err := probe(ctx, remote)
+		if err == nil {
+			return o, nil
+		}
+		if err != errProbeAmbiguous {
+			return nil, err
+		}
+		// Ambiguous - fall through to the listing lookup
+	}
+	return f.newObjectFromListing(ctx, remote)
+}
+
+// useProbe reports whether NewObject should probe remote directly
+// before falling back to the parent directory listing.
+//
+// Probes are skipped when the listing is needed anyway (raw metadata
+// only exists in listing entries, and non-default collision policies
+// must see whether a directory shares the name), or when the parent
+// listing is already cached and so cheaper than any request. no_head
+// additionally disables the HEAD probe, but not the ranged GET probe
+// selected by probe_mode=range.
+func (f *Fs) useProbe(remote string) bool {
+	if f.opt.NoHead && f.opt.ProbeMode != "range" {
+		return false
+	}
+	if f.opt.ExposeRawMetadata {
+		return false
+	}
+	switch f.opt.NameCollisionPolicy {
+	case "prefer-dir", "error":
+		return false
+	}
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	_, cached := f.cache.Get(dir)
+	return !cached
+}
+
+// newObjectFromListing finds the Object at remote via its parent
+// directory listing.
+func (f *Fs) newObjectFromListing(ctx context.Context, remote string) (fs.Object, error) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	// The listing holds stored names so look the transliterated leaf up
+	leaf := path.Base(f.transliterate(remote))
+	list, err := f.list(ctx, dir)
+	if err != nil {
+		if err == fs.ErrorDirNotFound {
+			if f.opt.PackSmallFiles > 0 {
+				// The file may be pending in an unflushed pack
+				return f.packFind(ctx, remote)
+			}
+			return nil, fs.ErrorObjectNotFound
+		}
+		return nil, err
+	}
+	var fileObj *Object
+	for _, o := range list.Files(f, dir) {
+		if path.Base(o.remote) == leaf {
+			fileObj = o
+			break
+		}
+	}
+	dirExists := false
+	for i := range list {
+		if list[i].IsDirectory && f.opt.Enc.ToStandardPath(list[i].ObjectName) == leaf {
+			dirExists = true
+			break
+		}
+	}
+	if fileObj != nil && dirExists {
+		// bunny's path model allows a file and a directory with the
+		// same name - resolve per name_collision_policy
+		switch f.opt.NameCollisionPolicy {
+		case "prefer-dir":
+			return nil, fs.ErrorIsDir
+		case "error":
+			return nil, fmt.Errorf("%q is both a file and a directory - set name_collision_policy to resolve", remote)
+		default: // prefer-file
+		}
+	}
+	if fileObj != nil {
+		if fileObj.modTimeMissing && f.opt.MissingModtime == "error" {
+			return nil, fmt.Errorf("object %q has an unparseable timestamp", remote)
+		}
+		// Hand back the name the caller asked for, not the stored one
+		fileObj.remote = remote
+		return fileObj, nil
+	}
+	if dirExists {
+		return nil, fs.ErrorIsDir
+	}
+	if f.opt.PackSmallFiles > 0 {
+		return f.packFind(ctx, remote)
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// pathLock is one entry in the serialize_same_path lock table. It is
+// reference counted so entries vanish again once the last writer of a
+// path lets go.
+type pathLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockPath takes the per-path write lock for remote and returns the
+// function releasing it. A no-op unless serialize_same_path is set.
+func (f *Fs) lockPath(remote string) func() {
+	if !f.opt.SerializeSamePath {
+		return func() {}
+	}
+	f.pathLocksMu.Lock()
+	l := f.pathLocks[remote]
+	if l == nil {
+		if f.pathLocks == nil {
+			f.pathLocks = map[string]*pathLock{}
+		}
+		l = &pathLock{}
+		f.pathLocks[remote] = l
+	}
+	l.refs++
+	f.pathLocksMu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		f.pathLocksMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(f.pathLocks, remote)
+		}
+		f.pathLocksMu.Unlock()
+	}
+}
+
+// Put the object into the storage zone
+//
+// Copy the reader in to the new object which is returned.
+//
+// The new object may have been created if an error is returned
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if err := f.checkRemoteName(src.Remote()); err != nil {
+		return nil, err
+	}
+	if f.packSmallFile(src.Remote(), src.Size()) {
+		return f.putPacked(ctx, in, src)
+	}
+	o := &Object{
+		fs:      f,
+		remote:  src.Remote(),
+		size:    src.Size(),
+		modTime: src.ModTime(ctx),
+	}
+	err := o.Update(ctx, in, src, options...)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Mkdir creates the directory if it doesn't exist
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	if err := f.checkRemoteName(dir); err != nil {
+		return err
+	}
+	ctx, cancel := f.metadataCtx(ctx)
+	defer cancel()
+	req, err := f.newRequest(ctx, "PUT", f.dirPath(dir), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.doWithPacer(ctx, f.httpClient, req)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		apiErr := readError(resp)
+		// A conflict style status may just mean the directory is
+		// already there, which mustn't be an error - check with a
+		// listing before giving up
+		if _, listErr := f.list(ctx, dir); listErr == nil {
+			fs.Debugf(f, "Mkdir %q returned %s but the directory exists - treating as created", dir, resp.Status)
+			return nil
+		}
+		return fmt.Errorf("unable to create directory %q: %w", dir, apiErr)
+	}
+	f.clearDirCache(dir)
+	return nil
+}
+
+// purgeFast deletes dir and its contents with a single recursive
+// DELETE of the directory URL, then drops every cached listing under
+// it. Returns fs.ErrorDirNotFound on 404 so Purge can report a
+// missing directory, and the raw error otherwise so it can fall back
+// to the per-object walk.
+func (f *Fs) purgeFast(ctx context.Context, dir string) (err error) {
+	ctx, cancel := f.metadataCtx(ctx)
+	defer cancel()
+	req, err := f.newRequest(ctx, "DELETE", f.dirPath(dir), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.doWithPacer(ctx, f.httpClient, req)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+	case http.StatusNotFound:
+		return fs.ErrorDirNotFound
+	default:
+		return readError(resp)
+	}
+	f.cache.ClearUnder(dir)
+	f.clearDirCache(dir)
+	return nil
+}
+
+// Purge deletes all the files and the container
+//
+// A single recursive DELETE is tried first - bunny removes the whole
+// subtree server side, so no listing or per-object requests are
+// needed. If that is refused, or a resumable purge was requested via
+// purge_state_file, the deletes fall back to being done in parallel,
+// governed by --checkers. What happens when some of those deletes
+// fail is controlled by the purge_partial_policy option - the
+// directory placeholder itself is only removed once it has been fully
+// emptied.
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	// Purging the zone root deletes everything in the zone - too
+	// catastrophic for a stray command, so require an explicit opt in.
+	if dir == "" && f.root == "" && !f.opt.AllowRootPurge {
+		return errors.New("refusing to purge the root of the storage zone: set allow_root_purge to allow it")
+	}
+	// Make sure the directory exists so we return ErrorDirNotFound
+	// rather than silently succeeding.
+	if _, err := f.list(ctx, dir); err != nil {
+		return err
+	}
+	// bunny can delete a directory and its contents with a single
+	// DELETE, which is massively faster than walking the tree. Try
+	// that first unless a resumable purge was asked for - the walk is
+	// still there for zones which refuse it and for the read-only
+	// clearing and partial-failure policies it supports.
+	if f.opt.PurgeStateFile == "" {
+		switch err := f.purgeFast(ctx, dir); err {
+		case nil:
+			f.waitDirGone(ctx, dir)
+			return nil
+		case fs.ErrorDirNotFound:
+			return err
+		default:
+			fs.Debugf(f, "purge: recursive delete of %q failed (%v) - falling back to per-object deletes", dir, err)
+		}
+	}
+	state, err := openProgressState(f.opt.PurgeStateFile)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	failed, err := f.purgeDir(ctx, dir, state)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("purge: failed to delete %d objects: %s", len(failed), strings.Join(failed, ", "))
+	}
+	f.waitDirGone(ctx, dir)
+	return state.Remove()
+}
+
+// CleanUp removes leftover partial upload files - zero length objects
+// with rclone's ".partial" suffix - and deletes the directories this
+// emptied. Directories that were already empty before the cleanup are
+// left alone, and the root itself is never removed.
+func (f *Fs) CleanUp(ctx context.Context) error {
+	removedFiles, removedDirs := 0, 0
+	var cleanDir func(dir string) (empty, changed bool, err error)
+	cleanDir = func(dir string) (bool, bool, error) {
+		list, err := f.list(ctx, dir)
+		if err != nil {
+			return false, false, err
+		}
+		remaining := 0
+		changed := false
+		for i := range list {
+			item := &list[i]
+			remote := path.Join(dir, f.opt.Enc.ToStandardPath(item.ObjectName))
+			if item.IsDirectory {
+				empty, childChanged, err := cleanDir(remote)
+				if err != nil {
+					return false, false, err
+				}
+				changed = changed || childChanged
+				// Only delete a directory this cleanup emptied - one
+				// that was already empty is not ours to remove
+				if !empty || !childChanged {
+					remaining++
+					continue
+				}
+				if err := f.rmdir(ctx, remote); err != nil && err != fs.ErrorDirNotFound {
+					return false, false, err
+				}
+				removedDirs++
+				continue
+			}
+			if item.Length == 0 && strings.HasSuffix(item.ObjectName, ".partial") {
+				err := f.pacer.Call(func() (bool, error) {
+					removeErr := f.remove(ctx, remote)
+					if removeErr == fs.ErrorObjectNotFound {
+						removeErr = nil
+					}
+					return false, removeErr
+				})
+				if err != nil {
+					return false, false, err
+				}
+				removedFiles++
+				changed = true
+				continue
+			}
+			remaining++
+		}
+		f.cache.Clear(dir)
+		return remaining == 0, changed, nil
+	}
+	if _, _, err := cleanDir(""); err != nil {
+		return err
+	}
+	fs.Debugf(f, "cleanup: removed %d partial upload files and %d empty directories", removedFiles, removedDirs)
+	return nil
+}
+
+// progressState records which paths an operation has already handled
+// so an interrupted run can be resumed without repeating them. It is
+// used by resumable purges and by the scrub command.
+//
+// A nil progressState (no state file configured) is valid and records
+// nothing.
+type progressState struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	done map[string]bool
+}
+
+// openProgressState loads the state file at statePath, creating it if
+// needed.  It returns nil if statePath is empty.
+func openProgressState(statePath string) (*progressState, error) {
+	if statePath == "" {
+		return nil, nil
+	}
+	s := &progressState{path: statePath, done: map[string]bool{}}
+	data, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			s.done[line] = true
+		}
+	}
+	s.file, err = os.OpenFile(statePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+	return s, nil
+}
+
+// Done reports whether remote was already handled by a previous run
+func (s *progressState) Done(remote string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done[remote]
+}
+
+// MarkDone records that remote has been handled
+func (s *progressState) MarkDone(remote string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done[remote] = true
+	if _, err := s.file.WriteString(remote + "\n"); err != nil {
+		fs.Errorf(nil, "failed to record %q in state file: %v", remote, err)
+	}
+}
+
+// Close closes the state file
+func (s *progressState) Close() {
+	if s == nil {
+		return
+	}
+	_ = s.file.Close()
+}
+
+// Remove deletes the state file after a fully successful run
+func (s *progressState) Remove() error {
+	if s == nil {
+		return nil
+	}
+	_ = s.file.Close()
+	return os.Remove(s.path)
+}
+
+// copyCheckpoint records which objects have been uploaded and with
+// what checksum, so a re-run of an interrupted copy can skip them.
+// Unlike progressState the entries carry the SHA256 so a changed
+// source invalidates its entry.
+//
+// A nil copyCheckpoint (no checkpoint file configured) is valid and
+// records nothing.
+type copyCheckpoint struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]string // remote -> sha256
+}
+
+// openCopyCheckpoint loads the checkpoint file at checkpointPath,
+// creating it if needed. It returns nil if checkpointPath is empty.
+func openCopyCheckpoint(checkpointPath string) (*copyCheckpoint, error) {
+	if checkpointPath == "" {
+		return nil, nil
+	}
+	c := &copyCheckpoint{done: map[string]string{}}
+	data, err := os.ReadFile(checkpointPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if sum, remote, ok := strings.Cut(line, "\t"); ok {
+			c.done[remote] = sum
+		}
+	}
+	c.file, err = os.OpenFile(checkpointPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint file: %w", err)
+	}
+	return c, nil
+}
+
+// uploaded reports whether remote was already uploaded with exactly
+// this checksum by a previous run.
+func (c *copyCheckpoint) uploaded(remote, sha256sum string) bool {
+	if c == nil || sha256sum == "" {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[remote] == sha256sum
+}
+
+// mark records that remote was uploaded with this checksum. Uploads
+// without a known checksum aren't recorded - they couldn't be
+// verified before skipping.
+func (c *copyCheckpoint) mark(remote, sha256sum string) {
+	if c == nil || sha256sum == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done[remote] = sha256sum
+	if _, err := c.file.WriteString(sha256sum + "\t" + remote + "\n"); err != nil {
+		fs.Errorf(nil, "failed to record %q in checkpoint file: %v", remote, err)
+	}
+}
+
+// close closes the checkpoint file
+func (c *copyCheckpoint) close() {
+	if c == nil {
+		return
+	}
+	_ = c.file.Close()
+}
+
+// purgeDir removes the contents of dir and then dir itself, returning
+// the paths which couldn't be deleted.
+//
+// Under the "abort" policy the first delete error is returned in err,
+// under "continue" failures accumulate into failed.
+func (f *Fs) purgeDir(ctx context.Context, dir string, state *progressState) (failed []string, err error) {
+	abortOnError := f.opt.PurgePartialPolicy != "continue"
+	list, err := f.list(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	// Delete the files in parallel
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	var mu sync.Mutex
+	for i := range list {
+		if list[i].IsDirectory {
+			continue
+		}
+		// Note this includes metadata sidecars which Files() hides
+		remote := path.Join(dir, f.opt.Enc.ToStandardPath(list[i].ObjectName))
+		if state.Done(remote) {
+			fs.Debugf(f, "purge: skipping %q already deleted by a previous run", remote)
+			continue
+		}
+		g.Go(func() error {
+			deleteErr := f.remove(gCtx, remote)
+			if deleteErr == fs.ErrorObjectNotFound {
+				deleteErr = nil
+			}
+			if deleteErr == nil {
+				state.MarkDone(remote)
+			}
+			if deleteErr != nil {
+				if abortOnError {
+					return fmt.Errorf("purge: failed to delete %q: %w", remote, deleteErr)
+				}
+				fs.Errorf(f, "purge: failed to delete %q: %v", remote, deleteErr)
+				mu.Lock()
+				failed = append(failed, remote)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return failed, err
+	}
+	// Then recurse into the subdirectories
+	for _, d := range list.Dirs(f, dir) {
+		subFailed, err := f.purgeDir(ctx, d.Remote(), state)
+		failed = append(failed, subFailed...)
+		if err != nil {
+			return failed, err
+		}
+	}
+	f.cache.Clear(dir)
+	f.clearDirCache(dir)
+	if len(failed) > 0 {
+		// Not fully emptied so leave the directory placeholder alone
+		return failed, nil
+	}
+	if dir == "" {
+		// Don't delete the root itself
+		return nil, nil
+	}
+	// Everything in dir was deleted by this run or recorded as deleted
+	// by a previous one, so delete the directory directly - a listing
+	// lagging behind the deletes would make the Rmdir empty check fail
+	// spuriously.
+	err = f.rmdir(ctx, dir)
+	if err == fs.ErrorDirNotFound {
+		err = nil
+	}
+	return failed, err
+}
+
+// Rmdir removes the directory if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	// Bunny's directory delete is recursive so check the directory is
+	// empty first.
+	list, err := f.list(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if len(list) > 0 {
+		return fs.ErrorDirectoryNotEmpty
+	}
+	return f.rmdir(ctx, dir)
+}
+
+// rmdir deletes the directory without checking it is empty.
+//
+// Bunny's directory delete is recursive so callers must have emptied
+// the directory (or be happy for its contents to go too).
+func (f *Fs) rmdir(ctx context.Context, dir string) error {
+	ctx, cancel := f.metadataCtx(ctx)
+	defer cancel()
+	req, err := f.newRequest(ctx, "DELETE", f.dirPath(dir), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.doWithPacer(ctx, f.httpClient, req)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+	case http.StatusNotFound:
+		return fs.ErrorDirNotFound
+	default:
+		return fmt.Errorf("unable to remove directory %q: %w", dir, readError(resp))
+	}
+	f.cache.Clear(dir)
+	f.clearDirCache(dir)
+	return nil
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// bunny has no server side copy, so the object is streamed down and
+// back up within the zone - except when the destination already holds
+// an object with the same SHA256 and size, in which case the data
+// transfer is skipped entirely and the existing object is the result.
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || srcObj.fs.opt.StorageZone != f.opt.StorageZone {
+		fs.Debugf(src, "Can't copy - not same storage zone")
+		return nil, fs.ErrorCantCopy
+	}
+	if srcObj.packed {
+		// A packed file has no individual object to stream from - let
+		// the sync engine fall back to a streamed copy via Open
+		fs.Debugf(src, "Can't copy - source is held in a pack")
+		return nil, fs.ErrorCantCopy
+	}
+	if err := f.checkRemoteName(remote); err != nil {
+		return nil, err
+	}
+	if srcObj.sha256 != "" {
+		dst, err := f.NewObject(ctx, remote)
+		switch err {
+		case nil:
+			dstObj := dst.(*Object)
+			if dstObj.sha256 == srcObj.sha256 && dstObj.size == srcObj.size {
+				fs.Debugf(srcObj, "copy: destination %q already has identical content - skipping data transfer", remote)
+				return dst, nil
+			}
+		case fs.ErrorObjectNotFound:
+		default:
+			return nil, err
+		}
+	}
+	item := &api.DirItem{Length: srcObj.size, Checksum: strings.ToUpper(srcObj.sha256)}
+	if err := f.copyFileRaw(ctx, srcObj.fs, srcObj.remote, remote, item); err != nil {
+		return nil, err
+	}
+	f.refreshCacheEntry(ctx, remote)
+	return f.NewObject(ctx, remote)
+}
+
+// Move src to this remote using server-side move operations.
+//
+// bunny has no server side rename so the object is streamed to its
+// new path within the zone and the source deleted afterwards. With
+// move_overwrite_policy "if-newer" an up to date destination isn't
+// rewritten - the source is just deleted.
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || srcObj.fs.opt.StorageZone != f.opt.StorageZone {
+		fs.Debugf(src, "Can't move - not same storage zone")
+		return nil, fs.ErrorCantMove
+	}
+	if srcObj.packed {
+		// A packed file has no individual object to stream from - let
+		// the sync engine fall back to copy and delete via Open
+		fs.Debugf(src, "Can't move - source is held in a pack")
+		return nil, fs.ErrorCantMove
+	}
+	if err := f.checkRemoteName(remote); err != nil {
+		return nil, err
+	}
+	overwrite := true
+	if f.opt.MoveOverwritePolicy == "if-newer" {
+		dst, err := f.NewObject(ctx, remote)
+		switch err {
+		case nil:
+			overwrite = shouldOverwrite(srcObj, dst.(*Object))
+		case fs.ErrorObjectNotFound:
+		default:
+			return nil, err
+		}
+	}
+	if overwrite {
+		item := &api.DirItem{Length: srcObj.size, Checksum: strings.ToUpper(srcObj.sha256)}
+		if err := f.moveFileRaw(ctx, srcObj.fs, srcObj.remote, remote, item); err != nil {
+			return nil, err
+		}
+	} else {
+		fs.Debugf(srcObj, "move: destination %q is up to date - not rewriting it", remote)
+		if err := srcObj.fs.remove(ctx, srcObj.remote); err != nil {
+			return nil, err
+		}
+	}
+	// The source is known gone and only the destination entry changed
+	// - patch the caches instead of invalidating both directories
+	srcObj.fs.dropCacheEntry(srcObj.remote)
+	f.refreshCacheEntry(ctx, remote)
+	return f.NewObject(ctx, remote)
+}
+
+// shouldOverwrite reports whether src should replace dst under the
+// if-newer move policy. Identical content is never rewritten; when
+// the checksums aren't both known the source wins only if it is
+// newer.
+func shouldOverwrite(src, dst *Object) bool {
+	if src.sha256 != "" && dst.sha256 != "" {
+		return src.sha256 != dst.sha256
+	}
+	return src.modTime.After(dst.modTime)
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// bunny has no server side rename so each object is streamed to its
+// new path within the zone and the source is deleted afterwards. The
+// behaviour when dstRemote already exists is controlled by the
+// dir_move_policy option, defaulting to fs.ErrorDirExists.
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok || srcFs.opt.StorageZone != f.opt.StorageZone {
+		fs.Debugf(src, "Can't move directory - not same storage zone")
+		return fs.ErrorCantDirMove
+	}
+	// The source must exist
+	if _, err := srcFs.list(ctx, srcRemote); err != nil {
+		return err
+	}
+	// Apply dir_move_policy if the destination exists
+	_, err := f.list(ctx, dstRemote)
+	switch err {
+	case nil:
+		switch f.opt.DirMovePolicy {
+		case "merge":
+			// Move the entries into the existing directory
+		case "replace":
+			if err := f.rmdir(ctx, dstRemote); err != nil && err != fs.ErrorDirNotFound {
+				return err
+			}
+			f.cache.Clear(dstRemote)
+		default:
+			return fs.ErrorDirExists
+		}
+	case fs.ErrorDirNotFound:
+	default:
+		return err
+	}
+	if err := f.moveDirContents(ctx, srcFs, srcRemote, dstRemote); err != nil {
+		return err
+	}
+	// Remove what is left of the source tree - the files have gone so
+	// the recursive delete only removes directory placeholders.
+	err = srcFs.rmdir(ctx, srcRemote)
+	if err == fs.ErrorDirNotFound {
+		err = nil
+	}
+	srcFs.cache.ClearAll()
+	f.cache.ClearAll()
+	return err
+}
+
+// PublicLink generates a public link to the remote path, served
+// through the pull zone configured with pull_zone_hostname.
+//
+// With token_auth_key set the link is signed with bunny's URL token
+// authentication scheme and expires after the requested duration,
+// otherwise a plain unsigned URL is returned and expire is ignored.
+func (f *Fs) PublicLink(ctx context.Context, remote string, expire fs.Duration, unlink bool) (string, error) {
+	if f.opt.PullZoneHostname == "" {
+		return "", errors.New("can't generate a public link: pull_zone_hostname is not set")
+	}
+	if unlink {
+		return "", errors.New("bunny links can't be removed - disable token authentication on the pull zone instead")
+	}
+	if _, err := f.NewObject(ctx, remote); err != nil {
+		return "", err
+	}
+	base := f.opt.PullZoneHostname
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+	base = strings.TrimSuffix(base, "/")
+	// The pull zone serves the storage zone root, so the URL path is
+	// the stored path without the zone name
+	urlPath := strings.TrimPrefix(f.getFullFilePath(remote), f.opt.StorageZone)
+	if f.opt.TokenAuthKey == "" {
+		return base + urlPath, nil
+	}
+	duration := time.Duration(expire)
+	if expire <= 0 || expire == fs.DurationOff {
+		duration = 24 * time.Hour
+	}
+	expires := time.Now().Add(duration).Unix()
+	sum := sha256.Sum256([]byte(f.opt.TokenAuthKey + urlPath + strconv.FormatInt(expires, 10)))
+	token := base64.RawURLEncoding.EncodeToString(sum[:])
+	return fmt.Sprintf("%s%s?token=%s&expires=%d", base, urlPath, token, expires), nil
+}
+
+// moveDirContents recursively moves the entries of srcDir on srcFs
+// into dstDir on f.
+func (f *Fs) moveDirContents(ctx context.Context, srcFs *Fs, srcDir, dstDir string) error {
+	list, err := srcFs.list(ctx, srcDir)
+	if err != nil {
+		return err
+	}
+	if err := f.Mkdir(ctx, dstDir); err != nil {
+		return err
+	}
+	for i := range list {
+		// Move raw entries so metadata sidecars travel too
+		name := f.opt.Enc.ToStandardPath(list[i].ObjectName)
+		if list[i].IsDirectory {
+			err = f.moveDirContents(ctx, srcFs, path.Join(srcDir, name), path.Join(dstDir, name))
+		} else {
+			err = f.moveFileRaw(ctx, srcFs, path.Join(srcDir, name), path.Join(dstDir, name), &list[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveFileRaw copies the file at srcRemote on srcFs to dstRemote on f
+// and deletes the source.
+func (f *Fs) moveFileRaw(ctx context.Context, srcFs *Fs, srcRemote, dstRemote string, item *api.DirItem) error {
+	if err := f.copyFileRaw(ctx, srcFs, srcRemote, dstRemote, item); err != nil {
+		return err
+	}
+	return srcFs.remove(ctx, srcRemote)
+}
+
+// copyFileRaw streams the file at srcRemote on srcFs to dstRemote on
+// f, preserving any X-Rclone-* metadata headers stored with it.
+func (f *Fs) copyFileRaw(ctx context.Context, srcFs *Fs, srcRemote, dstRemote string, item *api.DirItem) (err error) {
+	req, err := srcFs.newRequest(ctx, "GET", srcFs.getFullFilePath(srcRemote), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := srcFs.doWithPacer(ctx, srcFs.httpClient, req)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return fs.ErrorObjectNotFound
+	default:
+		return fmt.Errorf("unable to read %q for copy: %w", srcRemote, readError(resp))
+	}
+	headers := map[string]string{}
+	for k := range resp.Header {
+		if strings.HasPrefix(k, "X-Rclone-") {
+			headers[k] = resp.Header.Get(k)
+		}
+	}
+	upResp, err := f.upload(ctx, dstRemote, resp.Body, item.Length, strings.ToLower(item.Checksum), headers)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(upResp.Body, &err)
+	if upResp.StatusCode != http.StatusCreated && upResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to write %q for copy: %w", dstRemote, uploadStatusErr(upResp))
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.fs
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// ModTime returns the modification time of the object
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.modTime
+}
+
+// Size returns the size of an object in bytes
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// Hash returns the SHA256 of an object
+func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
+	if t != hash.SHA256 {
+		return "", hash.ErrUnsupported
+	}
+	return o.sha256, nil
+}
+
+// Storable returns whether this object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// MimeType returns the content type of the object if known
+func (o *Object) MimeType(ctx context.Context) string {
+	return o.contentType
+}
+
+// ID returns the bunny Guid of the object, a stable server side
+// identifier independent of the path. It may be empty if the object
+// wasn't built from a listing entry.
+func (o *Object) ID() string {
+	return o.id
+}
+
+// SetModTime sets the modification time of the object
+//
+// bunny has no metadata-only update, so the content is streamed back
+// through and re-uploaded with the new timestamp in the mtime header,
+// preserving the other rclone headers on the object.
+func (o *Object) SetModTime(ctx context.Context, t time.Time) (err error) {
+	if o.packed {
+		// Rewriting the entry in its pack keeps the name packed - a
+		// plain re-upload would duplicate it as an individual object
+		if err := o.fs.setModTimePacked(ctx, o, t); err != nil {
+			return err
+		}
+		o.modTime = t
+		return nil
+	}
+	headers := map[string]string{
+		mtimeHeader: t.UTC().Format(time.RFC3339Nano),
+	}
+	if resp, headErr := o.fs.headObject(ctx, o.remote); headErr == nil {
+		if v := resp.Header.Get(xattrHeader); v != "" {
+			headers[xattrHeader] = v
+		}
+		if v := resp.Header.Get(originalNameHeader); v != "" {
+			headers[originalNameHeader] = v
+		}
+		// The re-upload would otherwise reset the stored content type
+		// to the server's guess
+		if v := resp.Header.Get("Content-Type"); v != "" {
+			headers["Content-Type"] = v
+		}
+	}
+	rc, err := o.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(rc, &err)
+	resp, err := o.fs.upload(ctx, o.remote, rc, o.size, o.sha256, headers)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to set modification time of %q: %w", o.remote, readError(resp))
+	}
+	o.modTime = t
+	o.fs.refreshCacheEntry(ctx, o.remote)
+	return nil
+}
+
+// Open an object for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	if o.packed {
+		return o.openPacked(ctx, options...)
+	}
+	if o.fs.opt.RetryOnCorruption > 0 && o.sha256 != "" && !rangedRead(options) {
+		return o.openVerified(ctx, options...)
+	}
+	rc, err := o.open(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	if o.fs.opt.VerifyDownload && o.sha256 != "" && !rangedRead(options) {
+		// Hash the stream as it is read and fail the read at EOF on a
+		// mismatch - partial reads can't be verified so they skip this
+		rc = &verifyingReadCloser{rc: rc, hasher: sha256.New(), want: o.sha256, remote: o.remote}
+	}
+	return rc, nil
+}
+
+// verifyingReadCloser hashes everything read through it and turns the
+// final EOF into an error when the content doesn't match the expected
+// SHA256. A stream closed before EOF is never verified.
+type verifyingReadCloser struct {
+	rc     io.ReadCloser
+	hasher gohash.Hash
+	want   string
+	remote string
+}
+
+// Read implements io.Reader, verifying the checksum at EOF
+func (v *verifyingReadCloser) Read(p []byte) (int, error) {
+	n, err := v.rc.Read(p)
+	if n > 0 {
+		_, _ = v.hasher.Write(p[:n])
+	}
+	if err == io.EOF {
+		if sum := hex.EncodeToString(v.hasher.Sum(nil)); sum != v.want {
+			return n, fmt.Errorf("corrupted download of %q: SHA256 %s doesn't match the stored checksum %s", v.remote, sum, v.want)
+		}
+	}
+	return n, err
+}
+
+// Close closes the underlying stream
+func (v *verifyingReadCloser) Close() error {
+	return v.rc.Close()
+}
+
+// rangedRead reports whether options ask for anything other than the
+// whole object.
+func rangedRead(options []fs.OpenOption) bool {
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.RangeOption:
+			return true
+		case *fs.SeekOption:
+			if x.Offset != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// openVerified downloads the whole object, checks it against the
+// stored checksum and refetches from scratch on a mismatch, up to
+// retry_on_corruption times. The verified content is served from
+// memory.
+func (o *Object) openVerified(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var lastErr error
+	for try := 1; try <= o.fs.opt.RetryOnCorruption+1; try++ {
+		rc, err := o.open(ctx, options...)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		closeErr := rc.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) == o.sha256 {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		lastErr = fmt.Errorf("corrupted download of %q: content doesn't match the stored checksum", o.remote)
+		fs.Debugf(o, "%v (attempt %d/%d) - retrying", lastErr, try, o.fs.opt.RetryOnCorruption+1)
+	}
+	return nil, lastErr
+}
+
+// open performs the GET for Open without verification, going via the
+// pull zone when download_via_cdn is enabled.
+func (o *Object) open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	fs.FixRangeOption(options, o.size)
+	if o.fs.opt.DownloadViaCDN {
+		rc, err := o.openCDN(ctx, options...)
+		if err != fs.ErrorObjectNotFound {
+			return rc, err
+		}
+		// A fresh upload the CDN hasn't cached yet - the origin has it
+		fs.Debugf(o, "not on the pull zone yet - falling back to the origin")
+	}
+	return o.openOrigin(ctx, options...)
+}
+
+// openOrigin downloads from the storage origin
+func (o *Object) openOrigin(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	ctx, cancel := o.fs.transferCtx(ctx, o.size)
+	req, err := o.fs.newRequest(ctx, "GET", o.fs.getFullFilePath(o.remote), nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	fs.OpenOptionAddHTTPHeaders(req.Header, options)
+	// Reads may go via a caching proxy - writes always go direct
+	return o.doOpen(ctx, cancel, o.fs.readClient, req)
+}
+
+// openCDN downloads from the pull zone, signing the URL when token
+// authentication is configured. A 404 comes back as
+// fs.ErrorObjectNotFound so open can fall back to the origin.
+func (o *Object) openCDN(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	ctx, cancel := o.fs.transferCtx(ctx, o.size)
+	u := o.fs.pullZoneURL(o.remote)
+	if key := o.fs.opt.TokenAuthKey; key != "" {
+		urlPath := strings.TrimPrefix(o.fs.getFullFilePath(o.remote), o.fs.opt.StorageZone)
+		expires := time.Now().Add(time.Hour).Unix()
+		sum := sha256.Sum256([]byte(key + urlPath + strconv.FormatInt(expires, 10)))
+		u = fmt.Sprintf("%s?token=%s&expires=%d", u, base64.RawURLEncoding.EncodeToString(sum[:]), expires)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	fs.OpenOptionAddHTTPHeaders(req.Header, options)
+	// The pull zone is public - no AccessKey and no caching proxy
+	return o.doOpen(ctx, cancel, o.fs.httpClient, req)
+}
+
+// doOpen sends req and wraps the body up for Open
+func (o *Object) doOpen(ctx context.Context, cancel context.CancelFunc, client *http.Client, req *http.Request) (io.ReadCloser, error) {
+	var resp *http.Response
+	err := o.fs.pacer.Call(func() (bool, error) {
+		var reqErr error
+		resp, reqErr = client.Do(req)
+		retry, retryErr := o.fs.shouldRetry(ctx, resp, reqErr)
+		if retry {
+			drainAndClose(resp)
+		}
+		return retry, retryErr
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusNotFound:
+		_ = resp.Body.Close()
+		cancel()
+		return nil, fs.ErrorObjectNotFound
+	default:
+		apiErr := readError(resp)
+		cancel()
+		return nil, fmt.Errorf("unable to download file %q: %w", o.remote, apiErr)
+	}
+	// The deadline stands until the stream is closed
+	body := io.ReadCloser(&cancelReadCloser{ReadCloser: resp.Body, cancel: cancel})
+	if o.fs.opt.ReadBufferSize > 0 {
+		return newBufferedReadCloser(body, int(o.fs.opt.ReadBufferSize)), nil
+	}
+	return body, nil
+}
+
+// bufferedReadCloser reads the wrapped stream through a bufio.Reader
+// so many small reads don't each hit the network.
+type bufferedReadCloser struct {
+	*bufio.Reader
+	rc io.ReadCloser
+}
+
+func newBufferedReadCloser(rc io.ReadCloser, size int) *bufferedReadCloser {
+	return &bufferedReadCloser{
+		Reader: bufio.NewReaderSize(rc, size),
+		rc:     rc,
+	}
+}
+
+// Close closes the underlying stream
+func (b *bufferedReadCloser) Close() error {
+	return b.rc.Close()
+}
+
+// spoolMemoryLimit is how much of an unknown-size upload is spooled
+// in memory before spilling to a temporary file.
+const spoolMemoryLimit = 8 * 1024 * 1024
+
+// spoolUnknownSize reads all of in into a local spool - memory up to
+// spoolMemoryLimit, a temporary file beyond that - and returns a
+// rewindable reader over the content along with its size and SHA256.
+// cleanup must be called once the content has been consumed.
+func spoolUnknownSize(in io.Reader) (spooled io.Reader, cleanup func(), size int64, sha256sum string, err error) {
+	hasher := sha256.New()
+	in = io.TeeReader(in, hasher)
+	cleanup = func() {}
+	var buf bytes.Buffer
+	size, err = io.CopyN(&buf, in, spoolMemoryLimit)
+	if err == io.EOF {
+		return bytes.NewReader(buf.Bytes()), cleanup, size, hex.EncodeToString(hasher.Sum(nil)), nil
+	}
+	if err != nil {
+		return nil, cleanup, 0, "", err
+	}
+	// Too big for memory - spill to a temporary file
+	file, err := os.CreateTemp("", "rclone-bunny-spool-")
+	if err != nil {
+		return nil, cleanup, 0, "", err
+	}
+	cleanup = func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+	rest, err := io.Copy(file, io.MultiReader(&buf, in))
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, cleanup, 0, "", err
+	}
+	return file, cleanup, rest, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+//
+// The new object may have been created if an error is returned
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	defer o.fs.lockPath(o.remote)()
+	if o.packed {
+		// Drop the packed copy - the new content is stored as an
+		// individual object
+		if err := o.fs.removePacked(ctx, o); err != nil && err != fs.ErrorObjectNotFound {
+			return err
+		}
+		o.packed = false
+		o.packRemote = ""
+	} else if o.fs.opt.PackSmallFiles > 0 {
+		// A fresh Put doesn't know the name's history - drop any packed
+		// copy left from when the file was below the pack threshold, or
+		// the listing would show it twice
+		if err := o.fs.removePacked(ctx, &Object{fs: o.fs, remote: o.remote}); err != nil && err != fs.ErrorObjectNotFound {
+			return err
+		}
+	}
+	size := src.Size()
+	srcHash := ""
+	if !o.fs.opt.DisableChecksum {
+		// Hashing may mean a second read of a slow source - skipped
+		// entirely with disable_checksum
+		if sum, hashErr := src.Hash(ctx, hash.SHA256); hashErr == nil {
+			srcHash = sum
+		}
+	}
+	if size < 0 {
+		// A streaming upload (rcat etc.) of unknown length - bunny
+		// needs a correct Content-Length, so spool the content first
+		// to learn its size and checksum
+		spooled, cleanup, spooledSize, spooledHash, spoolErr := spoolUnknownSize(in)
+		if spoolErr != nil {
+			return fmt.Errorf("failed to spool unknown-size upload of %q: %w", o.remote, spoolErr)
+		}
+		defer cleanup()
+		in, size = spooled, spooledSize
+		if !o.fs.opt.DisableChecksum {
+			srcHash = spooledHash
+		}
+	}
+	if srcHash == "" && !o.fs.opt.DisableChecksum {
+		// Trust a pre-supplied checksum from checksum_manifest so the
+		// zone can still verify the transfer
+		srcHash = o.fs.manifestHash(o.remote)
+	}
+	if o.fs.checkpoint.uploaded(o.remote, srcHash) {
+		fs.Debugf(o, "copy_checkpoint: already uploaded with this checksum - skipping")
+		o.size = size
+		o.modTime = src.ModTime(ctx)
+		o.sha256 = srcHash
+		return nil
+	}
+	meta, err := fs.GetMetadataOptions(ctx, o.fs, src, options)
+	if err != nil {
+		return err
+	}
+	xattrs, sidecar, err := serializeMetadata(userMetadata(meta))
+	if err != nil {
+		return err
+	}
+	// Send the content type so the pull zone serves the object
+	// correctly, preferring an explicit one from the source metadata
+	// over the extension based guess
+	contentType := fs.MimeType(ctx, src)
+	if ct := meta["content-type"]; ct != "" {
+		contentType = ct
+	}
+	// An mtime in the metadata map likewise beats the source's own
+	// modification time
+	modTime := src.ModTime(ctx)
+	if v := meta["mtime"]; v != "" {
+		if metaTime, parseErr := time.Parse(time.RFC3339Nano, v); parseErr == nil {
+			modTime = metaTime
+		} else {
+			fs.Debugf(o, "ignoring invalid mtime metadata %q: %v", v, parseErr)
+		}
+	}
+	headers := map[string]string{
+		mtimeHeader:    modTime.UTC().Format(time.RFC3339Nano),
+		"Content-Type": contentType,
+	}
+	if xattrs != "" && !sidecar {
+		headers[xattrHeader] = xattrs
+	}
+	resp, err := o.fs.upload(ctx, o.remote, in, size, srcHash, headers)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusInsufficientStorage {
+			_ = resp.Body.Close()
+			return errStorageFull
+		}
+		apiErr := readError(resp)
+		if isReadOnlyError(apiErr) {
+			return o.fs.retryReadOnlyUpload(ctx, o, in, size, srcHash, headers, apiErr)
+		}
+		return fmt.Errorf("unable to upload file %q: %w", o.remote, apiErr)
+	}
+	_ = resp.Body.Close()
+	if err := o.checkUploadChecksum(resp, srcHash); err != nil {
+		return err
+	}
+	err = o.fs.updateSidecar(ctx, o.remote, xattrs, sidecar, meta != nil)
+	if err != nil {
+		return err
+	}
+	o.size = size
+	o.modTime = modTime
+	o.contentType = contentType
+	o.fs.recordManifestEntry(o.remote, size, o.sha256)
+	o.fs.recordRecentWrite(o.remote)
+	o.fs.checkpoint.mark(o.remote, srcHash)
+	// Patch just this object into the cached listing rather than
+	// throwing the whole directory away
+	o.fs.refreshCacheEntry(ctx, o.remote)
+	return nil
+}
+
+// loadChecksumManifest reads a manifest file (as written by the
+// upload_manifest option - a JSON array of path/size/sha256 entries)
+// and indexes the checksums by path for uploads to use.
+func (f *Fs) loadChecksumManifest(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var entries []manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	f.manifestHashes = make(map[string]string, len(entries))
+	for _, entry := range entries {
+		f.manifestHashes[entry.Path] = strings.ToLower(entry.SHA256)
+	}
+	return nil
+}
+
+// manifestHash returns the checksum_manifest SHA256 for remote, or ""
+// if there isn't one.
+func (f *Fs) manifestHash(remote string) string {
+	return f.manifestHashes[path.Join(f.root, f.opt.StripPrefix, remote)]
+}
+
+// recordManifestEntry notes a completed upload for the upload_manifest
+// option. A no-op unless the option is set.
+func (f *Fs) recordManifestEntry(remote string, size int64, sha256sum string) {
+	if f.opt.UploadManifest == "" {
+		return
+	}
+	f.manifestMu.Lock()
+	defer f.manifestMu.Unlock()
+	if f.manifest == nil {
+		f.manifest = map[string]manifestEntry{}
+	}
+	zonePath := path.Join(f.root, f.opt.StripPrefix, remote)
+	f.manifest[zonePath] = manifestEntry{Path: zonePath, Size: size, SHA256: sha256sum}
+}
+
+// writeManifest uploads the accumulated upload manifest to the zone
+// root. A no-op if nothing was uploaded.
+func (f *Fs) writeManifest(ctx context.Context) (err error) {
+	f.manifestMu.Lock()
+	entries := make([]manifestEntry, 0, len(f.manifest))
+	for _, entry := range f.manifest {
+		entries = append(entries, entry)
+	}
+	f.manifestMu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	// The manifest goes to the zone root whatever f.root is
+	fullPath := rest.URLPathEscape(path.Join(f.opt.StorageZone, f.opt.UploadManifest))
+	req, err := f.newRequest(ctx, "PUT", fullPath, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(data))
+	resp, err := f.doWithPacer(ctx, f.httpClient, req)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to write upload manifest: %w", uploadStatusErr(resp))
+	}
+	fs.Infof(f, "wrote upload manifest %q with %d entries", f.opt.UploadManifest, len(entries))
+	return nil
+}
+
+// Shutdown the backend, flushing any pending packs, writing the
+// upload manifest if one is due and releasing resources: the
+// directory cache is cleared and idle connections are closed so a
+// long-lived daemon (mount, rcd) frees its sockets on unmount.
+//
+// Shutdown is idempotent - a second call just finds nothing left to
+// flush.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	err := f.flushAllPacks(ctx)
+	f.checkpoint.close()
+	if manifestErr := f.writeManifest(ctx); err == nil {
+		err = manifestErr
+	}
+	f.cache.ClearAll()
+	closeIdleConnections(f.httpClient.Transport)
+	if f.readClient != f.httpClient {
+		closeIdleConnections(f.readClient.Transport)
+	}
+	return err
+}
+
+// checkUploadChecksum compares the checksum bunny returned for an
+// upload against the source hash, storing the result on the object.
+//
+// An integrity error is returned on mismatch so silent corruption in
+// transit is caught.
+func (o *Object) checkUploadChecksum(resp *http.Response, srcHash string) error {
+	serverHash := strings.ToLower(resp.Header.Get("Checksum"))
+	srcHash = strings.ToLower(srcHash)
+	if serverHash != "" && srcHash != "" && serverHash != srcHash {
+		return fmt.Errorf("upload integrity check failed for %q: source SHA256 %s but server stored %s", o.remote, srcHash, serverHash)
+	}
+	if serverHash != "" {
+		o.sha256 = serverHash
+	} else {
+		o.sha256 = srcHash
+	}
+	return nil
+}
+
+// userMetadata returns the user defined entries of meta, dropping
+// system keys which are stored natively.
+func userMetadata(meta fs.Metadata) fs.Metadata {
+	if len(meta) == 0 {
+		return nil
+	}
+	out := fs.Metadata{}
+	for k, v := range meta {
+		switch k {
+		case "mtime", "content-type":
+			continue
+		}
+		out[k] = v
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// serializeMetadata serializes meta to JSON returning whether it is
+// too big for a header and needs a sidecar object.
+func serializeMetadata(meta fs.Metadata) (serialized string, sidecar bool, err error) {
+	if len(meta) == 0 {
+		return "", false, nil
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to serialize metadata: %w", err)
+	}
+	return string(data), len(data) > xattrHeaderLimit, nil
+}
+
+// updateSidecar creates or removes the metadata sidecar for remote as
+// needed after an upload.
+//
+// metaSupplied should be true if the source had metadata at all -
+// stale sidecars are only removed in that case so that uploads without
+// --metadata don't destroy existing metadata.
+func (f *Fs) updateSidecar(ctx context.Context, remote, xattrs string, sidecar, metaSupplied bool) error {
+	sidecarRemote := remote + metadataSidecarSuffix
+	if sidecar {
+		body := strings.NewReader(xattrs)
+		resp, err := f.upload(ctx, sidecarRemote, body, int64(len(xattrs)), "", nil)
+		if err != nil {
+			return fmt.Errorf("failed to upload metadata sidecar: %w", err)
+		}
+		defer fs.CheckClose(resp.Body, &err)
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to upload metadata sidecar: %w", uploadStatusErr(resp))
+		}
+		return nil
+	}
+	if metaSupplied {
+		// Remove any stale sidecar from a previous version
+		err := f.remove(ctx, sidecarRemote)
+		if err != nil && err != fs.ErrorObjectNotFound {
+			fs.Debugf(f, "failed to remove stale metadata sidecar for %q: %v", remote, err)
+		}
+	}
+	return nil
+}
+
+// bufferedUploadReader coalesces small reads from the source into
+// full buffers so the transport sees large writes.
+//
+// bufio.Reader isn't enough here - it issues a single Read against the
+// source per fill, so a source dribbling a few bytes per Read would
+// still dribble through to the transport.
+type bufferedUploadReader struct {
+	src  io.Reader
+	buf  []byte
+	r, w int
+	err  error // deferred error from filling
+}
+
+func newBufferedUploadReader(src io.Reader, size int) *bufferedUploadReader {
+	return &bufferedUploadReader{src: src, buf: make([]byte, size)}
+}
+
+// Read implements io.Reader, filling the whole buffer from the source
+// before handing any of it out.
+func (b *bufferedUploadReader) Read(p []byte) (int, error) {
+	if b.r == b.w {
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.r, b.w = 0, 0
+		for b.w < len(b.buf) && b.err == nil {
+			var n int
+			n, b.err = b.src.Read(b.buf[b.w:])
+			b.w += n
+		}
+		if b.w == 0 {
+			return 0, b.err
+		}
+	}
+	n := copy(p, b.buf[b.r:b.w])
+	b.r += n
+	return n, nil
+}
+
+// transferRateFloor is the transfer rate assumed when scaling
+// per-transfer deadlines - a second of deadline is added per this many
+// bytes of payload.
+const transferRateFloor = 1024 * 1024
+
+// metadataCtx applies the short metadata_timeout deadline to ctx, for
+// quick payload-free calls like listings, HEADs and deletes.
+func (f *Fs) metadataCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := f.requestCtx(ctx)
+	if f.opt.MetadataTimeout <= 0 {
+		return ctx, cancel
+	}
+	ctx, cancel2 := context.WithTimeout(ctx, time.Duration(f.opt.MetadataTimeout))
+	return ctx, func() { cancel2(); cancel() }
+}
+
+// requestCtx applies the flat timeout option to ctx. It underlies
+// both metadataCtx and transferCtx so every storage request gets the
+// cap; when one of the finer grained timeouts is also set the soonest
+// deadline wins.
+func (f *Fs) requestCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.opt.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, time.Duration(f.opt.Timeout))
+}
+
+// transferCtx applies a deadline to ctx scaled for transferring size
+// bytes: transfer_timeout covers the fixed overheads plus a second per
+// MiB of payload. Transfers of unknown size get no deadline since
+// there is nothing to scale by.
+func (f *Fs) transferCtx(ctx context.Context, size int64) (context.Context, context.CancelFunc) {
+	ctx, cancel := f.requestCtx(ctx)
+	if f.opt.TransferTimeout <= 0 || size < 0 {
+		return ctx, cancel
+	}
+	timeout := time.Duration(f.opt.TransferTimeout) + time.Duration(size/transferRateFloor)*time.Second
+	ctx, cancel2 := context.WithTimeout(ctx, timeout)
+	return ctx, func() { cancel2(); cancel() }
+}
+
+// cancelReadCloser cancels a context when the wrapped body is closed,
+// releasing the per-transfer deadline timer with it.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the wrapped body and cancels the context
+func (c *cancelReadCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// upload issues a single PUT of remote to the storage endpoint
+func (f *Fs) upload(ctx context.Context, remote string, in io.Reader, size int64, srcHash string, headers map[string]string) (*http.Response, error) {
+	ctx, cancel := f.transferCtx(ctx, size)
+	rawIn := in
+	if f.opt.WriteBufferSize > 0 && size != 0 {
+		in = newBufferedUploadReader(in, int(f.opt.WriteBufferSize))
+	}
+	req, err := f.newRequest(ctx, "PUT", f.getFullFilePath(remote), in)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if size == 0 {
+		// Make the empty body explicit - a zero ContentLength with a
+		// plain reader would be sent as a chunked stream of unknown
+		// length instead of Content-Length: 0
+		req.Body = http.NoBody
+		req.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+	} else if rs, ok := rawIn.(io.ReadSeeker); ok {
+		// A seekable body can be replayed, letting doWithPacer retry
+		// retryable statuses; streaming bodies get a single attempt
+		req.GetBody = func() (io.ReadCloser, error) {
+			if _, seekErr := rs.Seek(0, io.SeekStart); seekErr != nil {
+				return nil, seekErr
+			}
+			return io.NopCloser(rs), nil
+		}
+	}
+	if srcHash != "" {
+		req.Header.Set("Checksum", strings.ToUpper(srcHash))
+	}
+	if stored := f.transliterate(remote); stored != remote {
+		// Record the original name so it can be recovered on download
+		req.Header.Set(originalNameHeader, url.QueryEscape(remote))
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := f.doWithPacer(ctx, f.httpClient, req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The deadline stands until the caller has read the response
+	resp.Body = &cancelReadCloser{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// headObject issues a HEAD request for remote returning the response.
+//
+// The response body is closed.
+func (f *Fs) headObject(ctx context.Context, remote string) (*http.Response, error) {
+	ctx, cancel := f.metadataCtx(ctx)
+	defer cancel()
+	req, err := f.newRequest(ctx, "HEAD", f.getFullFilePath(remote), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.doWithPacer(ctx, f.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		return nil, fs.ErrorObjectNotFound
+	}
+	return nil, readError(resp)
+}
+
+// Metadata returns the metadata stored with the object
+//
+// It reads the serialized user metadata from the object's headers,
+// falling back to the sidecar object for large metadata sets.
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	if o.probed {
+		// The probe response lacked listing-only fields such as the
+		// Guid and the replicated zones - fill them in best effort
+		// from the parent listing, which is usually still cached
+		if lo, err := o.fs.newObjectFromListing(ctx, o.remote); err == nil {
+			if lo, ok := lo.(*Object); ok {
+				o.id = lo.id
+				o.replicatedZones = lo.replicatedZones
+				o.raw = lo.raw
+				o.probed = false
+			}
+		} else {
+			fs.Debugf(o, "couldn't fetch listing metadata: %v", err)
+		}
+	}
+	meta := fs.Metadata{}
+	if !o.modTime.IsZero() {
+		meta["mtime"] = o.modTime.Format(time.RFC3339Nano)
+	}
+	if o.contentType != "" {
+		meta["content-type"] = o.contentType
+	}
+	// Where the object physically resides, for compliance and latency
+	// analysis of geo-replicated zones
+	meta["region"] = o.fs.region()
+	if o.replicatedZones != "" {
+		meta["replicated-zones"] = o.replicatedZones
+	}
+	if o.fs.opt.ExposeRawMetadata && o.raw != nil {
+		set := func(key, value string) {
+			if value != "" {
+				meta[key] = value
+			}
+		}
+		set("bunny-guid", o.raw.Guid)
+		set("bunny-storage-zone-name", o.raw.StorageZoneName)
+		set("bunny-path", o.raw.Path)
+		set("bunny-user-id", o.raw.UserId)
+		set("bunny-date-created", o.raw.DateCreated)
+		set("bunny-checksum", o.raw.Checksum)
+		set("bunny-replicated-zones", o.raw.ReplicatedZones)
+		meta["bunny-server-id"] = strconv.FormatInt(o.raw.ServerId, 10)
+		meta["bunny-array-number"] = strconv.FormatInt(o.raw.ArrayNumber, 10)
+		meta["bunny-storage-zone-id"] = strconv.FormatInt(o.raw.StorageZoneId, 10)
+	}
+	if o.metaComplete && o.packed {
+		// Everything came from the listing response and pack entries
+		// can't carry per object headers or a sidecar, so there is
+		// nothing further to fetch.
+		return meta, nil
+	}
+	// The listing populated the system metadata above, but user
+	// metadata lives in the xattr header or a sidecar which listings
+	// can't carry, so a HEAD is still needed for a faithful --metadata
+	// copy.
+	serialized := ""
+	resp, err := o.fs.headObject(ctx, o.remote)
+	if err != nil {
+		return nil, err
+	}
+	if encoded := resp.Header.Get(originalNameHeader); encoded != "" {
+		if original, decodeErr := url.QueryUnescape(encoded); decodeErr == nil {
+			meta["original-name"] = original
+		}
+	}
+	// Surface only the whitelisted response headers
+	for _, name := range strings.Split(o.fs.opt.MetadataHeaders, ",") {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if v := resp.Header.Get(name); v != "" {
+			meta[strings.ToLower(name)] = v
+		}
+	}
+	serialized = resp.Header.Get(xattrHeader)
+	if serialized == "" && (!o.metaComplete || o.hasSidecar) {
+		// No header - look for a sidecar, unless the listing the
+		// object came from already showed there isn't one
+		var readErr error
+		serialized, readErr = o.fs.readSidecar(ctx, o.remote)
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	if serialized != "" {
+		var xattrs map[string]string
+		if err := json.Unmarshal([]byte(serialized), &xattrs); err != nil {
+			return nil, fmt.Errorf("failed to parse stored metadata: %w", err)
+		}
+		for k, v := range xattrs {
+			meta[k] = v
+		}
+	}
+	return meta, nil
+}
+
+// readSidecar returns the contents of the metadata sidecar for remote,
+// or "" if there isn't one.
+func (f *Fs) readSidecar(ctx context.Context, remote string) (string, error) {
+	sidecarObj := &Object{fs: f, remote: remote + metadataSidecarSuffix, size: -1}
+	rc, err := sidecarObj.Open(ctx)
+	if err == fs.ErrorObjectNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer fs.CheckClose(rc, &err)
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// retryReadOnlyUpload handles an upload which failed because the object
+// is read-only, clearing the flag and retrying if allowed.
+func (f *Fs) retryReadOnlyUpload(ctx context.Context, o *Object, in io.Reader, size int64, srcHash string, headers map[string]string, apiErr *api.Error) error {
+	if !f.opt.ClearReadOnly {
+		return fmt.Errorf("object %q is read-only: set clear_read_only to overwrite it: %w", o.remote, apiErr)
+	}
+	if err := f.clearReadOnly(ctx, o.remote); err != nil {
+		return fmt.Errorf("object %q is read-only: %w", o.remote, err)
+	}
+	// The body may have been partially consumed by the failed attempt
+	// so rewind it if we can.
+	seeker, ok := in.(io.Seeker)
+	if !ok {
+		return fmt.Errorf("object %q is read-only: cleared the flag but can't rewind the input to retry - re-run the transfer", o.remote)
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("object %q is read-only: failed to rewind input for retry: %w", o.remote, err)
+	}
+	resp, err := f.upload(ctx, o.remote, in, size, srcHash, headers)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to upload file %q after clearing read-only flag: %w", o.remote, readError(resp))
+	}
+	if err := o.checkUploadChecksum(resp, srcHash); err != nil {
+		return err
+	}
+	o.size = size
+	f.clearDirCache(o.remote)
+	return nil
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	defer o.fs.lockPath(o.remote)()
+	if o.packed {
+		return o.fs.removePacked(ctx, o)
+	}
+	err := o.fs.remove(ctx, o.remote)
+	if err != nil {
+		apiErr := new(api.Error)
+		if errors.As(err, &apiErr) && isReadOnlyError(apiErr) {
+			if !o.fs.opt.ClearReadOnly {
+				return fmt.Errorf("object %q is read-only: set clear_read_only to delete it: %w", o.remote, apiErr)
+			}
+			if err := o.fs.clearReadOnly(ctx, o.remote); err != nil {
+				return fmt.Errorf("object %q is read-only: %w", o.remote, err)
+			}
+			err = o.fs.remove(ctx, o.remote)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// Remove any metadata sidecar too
+	if sidecarErr := o.fs.remove(ctx, o.remote+metadataSidecarSuffix); sidecarErr != nil && sidecarErr != fs.ErrorObjectNotFound {
+		fs.Debugf(o.fs, "failed to remove metadata sidecar for %q: %v", o.remote, sidecarErr)
+	}
+	o.fs.clearDirCache(o.remote)
+	o.fs.waitObjectGone(ctx, o.remote)
+	return nil
+}
+
+// waitObjectGone polls remote with HEAD requests until the zone stops
+// resolving it or delete_wait has elapsed. This gives tight scripts
+// read-after-delete consistency despite bunny's eventually consistent
+// listings. A no-op unless delete_wait is set.
+func (f *Fs) waitObjectGone(ctx context.Context, remote string) {
+	if f.opt.DeleteWait <= 0 {
+		return
+	}
+	deadline := time.Now().Add(time.Duration(f.opt.DeleteWait))
+	delay := 50 * time.Millisecond
+	for {
+		_, err := f.headObject(ctx, remote)
+		if err == fs.ErrorObjectNotFound {
+			return
+		}
+		if err != nil {
+			fs.Debugf(f, "delete_wait: giving up waiting for %q to disappear: %v", remote, err)
+			return
+		}
+		if time.Now().After(deadline) {
+			fs.Logf(f, "delete_wait: %q was still visible %v after its deletion", remote, f.opt.DeleteWait)
+			return
+		}
+		time.Sleep(delay)
+		if delay < time.Second {
+			delay *= 2
+		}
+	}
+}
+
+// waitDirGone polls the listing of dir until it is empty or gone, or
+// delete_wait has elapsed. A no-op unless delete_wait is set.
+func (f *Fs) waitDirGone(ctx context.Context, dir string) {
+	if f.opt.DeleteWait <= 0 {
+		return
+	}
+	deadline := time.Now().Add(time.Duration(f.opt.DeleteWait))
+	delay := 50 * time.Millisecond
+	for {
+		f.cache.Clear(dir)
+		list, err := f.list(ctx, dir)
+		if err == fs.ErrorDirNotFound || (err == nil && len(list) == 0) {
+			return
+		}
+		if err != nil {
+			fs.Debugf(f, "delete_wait: giving up waiting for %q to empty: %v", dir, err)
+			return
+		}
+		if time.Now().After(deadline) {
+			f.cache.Clear(dir)
+			fs.Logf(f, "delete_wait: %q still had %d entries %v after its purge", dir, len(list), f.opt.DeleteWait)
+			return
+		}
+		time.Sleep(delay)
+		if delay < time.Second {
+			delay *= 2
+		}
+	}
+}
+
+// remove issues a DELETE for remote
+func (f *Fs) remove(ctx context.Context, remote string) error {
+	ctx, cancel := f.metadataCtx(ctx)
+	defer cancel()
+	req, err := f.newRequest(ctx, "DELETE", f.getFullFilePath(remote), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.doWithPacer(ctx, f.httpClient, req)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return fs.ErrorObjectNotFound
+	}
+	return fmt.Errorf("unable to delete file %q: %w", remote, readError(resp))
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs           = (*Fs)(nil)
+	_ fs.ListRer      = (*Fs)(nil)
+	_ fs.Purger       = (*Fs)(nil)
+	_ fs.Copier       = (*Fs)(nil)
+	_ fs.Mover        = (*Fs)(nil)
+	_ fs.DirMover     = (*Fs)(nil)
+	_ fs.PublicLinker = (*Fs)(nil)
+	_ fs.CleanUpper   = (*Fs)(nil)
+	_ fs.Shutdowner   = (*Fs)(nil)
+	_ fs.Object       = (*Object)(nil)
+	_ fs.MimeTyper    = (*Object)(nil)
+	_ fs.IDer         = (*Object)(nil)
+	_ fs.Metadataer   = (*Object)(nil)
+)
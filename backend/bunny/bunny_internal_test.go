@@ -0,0 +1,4650 @@
+package bunny
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/rclone/rclone/backend/bunny/api"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/fshttp"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testZoneName  = "testzone"
+	testAccessKey = "test-access-key"
+)
+
+// zoneObject is a stored object in the fake zone
+type zoneObject struct {
+	data        []byte
+	contentType string
+	lastChanged time.Time
+	guid        string
+	headers     map[string]string // custom headers stored with the object
+}
+
+// testZone is an in-memory bunny storage zone used by the unit tests
+type testZone struct {
+	mu       sync.Mutex
+	objects  map[string]*zoneObject // keyed by path under the zone
+	dirs     map[string]bool        // explicitly created directories
+	readOnly map[string]bool        // objects marked read-only
+	requests []string               // log of "METHOD path" for assertions
+	guids    int
+	// replicatedZones, if set, is reported for every file in listings
+	replicatedZones string
+	// intercept, if set, is given first go at each request and
+	// returns true if it handled it
+	intercept func(w http.ResponseWriter, r *http.Request) bool
+}
+
+func newTestZone() *testZone {
+	return &testZone{
+		objects:  map[string]*zoneObject{},
+		dirs:     map[string]bool{},
+		readOnly: map[string]bool{},
+	}
+}
+
+// put stores an object in the zone directly
+func (z *testZone) put(remote, contents string) *zoneObject {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.guids++
+	obj := &zoneObject{
+		data:        []byte(contents),
+		contentType: "application/octet-stream",
+		lastChanged: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		guid:        fmt.Sprintf("guid-%04d", z.guids),
+		headers:     map[string]string{},
+	}
+	z.objects[remote] = obj
+	return obj
+}
+
+// countRequests returns how many logged requests match the prefix
+func (z *testZone) countRequests(prefix string) (n int) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for _, r := range z.requests {
+		if strings.HasPrefix(r, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// dirExists reports whether dir exists in the zone.
+// Must be called with the lock held.
+func (z *testZone) dirExists(dir string) bool {
+	if dir == "" {
+		return true
+	}
+	if z.dirs[dir] {
+		return true
+	}
+	prefix := dir + "/"
+	for name := range z.objects {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	for name := range z.dirs {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// listing builds the DirItem entries for dir.
+// Must be called with the lock held.
+func (z *testZone) listing(dir string) (items []api.DirItem) {
+	seenDirs := map[string]bool{}
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	appendDir := func(name string) {
+		if seenDirs[name] {
+			return
+		}
+		seenDirs[name] = true
+		items = append(items, api.DirItem{
+			Guid:        "dir-" + name,
+			Path:        "/" + testZoneName + "/" + prefix,
+			ObjectName:  name,
+			IsDirectory: true,
+			LastChanged: "2024-01-02T03:04:05",
+		})
+	}
+	for name, obj := range z.objects {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rel := name[len(prefix):]
+		if idx := strings.Index(rel, "/"); idx >= 0 {
+			appendDir(rel[:idx])
+			continue
+		}
+		sum := sha256.Sum256(obj.data)
+		items = append(items, api.DirItem{
+			Guid:            obj.guid,
+			Path:            "/" + testZoneName + "/" + prefix,
+			ObjectName:      rel,
+			Length:          int64(len(obj.data)),
+			LastChanged:     obj.lastChanged.UTC().Format("2006-01-02T15:04:05.999"),
+			ContentType:     obj.contentType,
+			Checksum:        strings.ToUpper(hex.EncodeToString(sum[:])),
+			ReplicatedZones: z.replicatedZones,
+		})
+	}
+	for name := range z.dirs {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rel := name[len(prefix):]
+		if idx := strings.Index(rel, "/"); idx >= 0 {
+			rel = rel[:idx]
+		}
+		appendDir(rel)
+	}
+	return items
+}
+
+func writeAPIError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"HttpCode": code,
+		"Message":  message,
+	})
+}
+
+// ServeHTTP implements a minimal bunny storage API for the zone
+func (z *testZone) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	z.mu.Lock()
+	z.requests = append(z.requests, r.Method+" "+r.URL.Path)
+	intercept := z.intercept
+	z.mu.Unlock()
+	if intercept != nil && intercept(w, r) {
+		return
+	}
+	if r.Header.Get("AccessKey") != testAccessKey {
+		writeAPIError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, "/"+testZoneName)
+	p = strings.TrimPrefix(p, "/")
+	isDir := p == "" || strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+
+	// Read PUT bodies before taking the lock so a streaming upload
+	// whose body is produced by concurrent requests to this same
+	// server can't deadlock the handler
+	var putBody *bytes.Buffer
+	if r.Method == "PUT" && !isDir {
+		putBody = new(bytes.Buffer)
+		_, _ = putBody.ReadFrom(r.Body)
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if isDir {
+		switch r.Method {
+		case "GET":
+			if !z.dirExists(p) {
+				writeAPIError(w, http.StatusNotFound, "Directory Not Found")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(z.listing(p))
+		case "PUT":
+			z.dirs[p] = true
+			w.WriteHeader(http.StatusCreated)
+		case "DELETE":
+			if !z.dirExists(p) {
+				writeAPIError(w, http.StatusNotFound, "Directory Not Found")
+				return
+			}
+			delete(z.dirs, p)
+			prefix := p + "/"
+			if p == "" {
+				prefix = ""
+			}
+			for name := range z.objects {
+				if strings.HasPrefix(name, prefix) {
+					delete(z.objects, name)
+				}
+			}
+			for name := range z.dirs {
+				if strings.HasPrefix(name, prefix) {
+					delete(z.dirs, name)
+				}
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+		return
+	}
+	switch r.Method {
+	case "GET", "HEAD":
+		obj, ok := z.objects[p]
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "Object Not Found")
+			return
+		}
+		sum := sha256.Sum256(obj.data)
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Checksum", strings.ToUpper(hex.EncodeToString(sum[:])))
+		w.Header().Set("Last-Modified", obj.lastChanged.UTC().Format(http.TimeFormat))
+		for k, v := range obj.headers {
+			w.Header().Set(k, v)
+		}
+		if rng := r.Header.Get("Range"); rng != "" && r.Method == "GET" {
+			serveRange(w, rng, obj.data)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(obj.data)))
+		if r.Method == "GET" {
+			_, _ = w.Write(obj.data)
+		}
+	case "PUT":
+		if z.readOnly[p] {
+			writeAPIError(w, http.StatusForbidden, "Object is read-only")
+			return
+		}
+		z.guids++
+		obj := &zoneObject{
+			data:        putBody.Bytes(),
+			contentType: r.Header.Get("Content-Type"),
+			lastChanged: time.Now().UTC(),
+			guid:        fmt.Sprintf("guid-%04d", z.guids),
+			headers:     map[string]string{},
+		}
+		if obj.contentType == "" {
+			obj.contentType = "application/octet-stream"
+		}
+		for k, vs := range r.Header {
+			if strings.HasPrefix(k, "X-Rclone-") && len(vs) > 0 {
+				obj.headers[k] = vs[0]
+			}
+		}
+		if sent := r.Header.Get("Checksum"); sent != "" {
+			sum := sha256.Sum256(obj.data)
+			if !strings.EqualFold(sent, hex.EncodeToString(sum[:])) {
+				writeAPIError(w, http.StatusBadRequest, "Checksum mismatch")
+				return
+			}
+		}
+		z.objects[p] = obj
+		sum := sha256.Sum256(obj.data)
+		w.Header().Set("Checksum", strings.ToUpper(hex.EncodeToString(sum[:])))
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		if z.readOnly[p] {
+			writeAPIError(w, http.StatusForbidden, "Object is read-only")
+			return
+		}
+		if _, ok := z.objects[p]; !ok {
+			writeAPIError(w, http.StatusNotFound, "Object Not Found")
+			return
+		}
+		delete(z.objects, p)
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// serveRange serves a single "bytes=a-b" range of data
+func serveRange(w http.ResponseWriter, rng string, data []byte) {
+	var start, end int64 = 0, int64(len(data)) - 1
+	_, _ = fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+	if end >= int64(len(data)) {
+		end = int64(len(data)) - 1
+	}
+	if start > end {
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", end-start+1))
+	w.WriteHeader(http.StatusPartialContent)
+	_, _ = w.Write(data[start : end+1])
+}
+
+// newTestFs creates an Fs talking to a fake zone server
+func newTestFs(t *testing.T, z *testZone, m configmap.Simple) *Fs {
+	ts := httptest.NewServer(z)
+	t.Cleanup(ts.Close)
+	if m == nil {
+		m = configmap.Simple{}
+	}
+	if _, ok := m["storage_zone"]; !ok {
+		m["storage_zone"] = testZoneName
+	}
+	if _, ok := m["access_key"]; !ok {
+		m["access_key"] = testAccessKey
+	}
+	// NewFs is called with the raw map so registry defaults don't
+	// apply - set the listing cache TTL the way the default would
+	if _, ok := m["list_cache_time"]; !ok {
+		m["list_cache_time"] = listCacheTTL.String()
+	}
+	if _, ok := m["encoding"]; !ok {
+		m["encoding"] = defaultEncoding.String()
+	}
+	// Point NewFs at the stub zone up front - the root file probe
+	// runs inside NewFs and must not hit the real endpoint
+	if _, ok := m["storage_endpoint"]; !ok {
+		m["storage_endpoint"] = ts.URL
+	}
+	// Tests that deliberately fail requests would otherwise wait out
+	// the full retry backoff against the local stub
+	_, minSet := m["pacer_min_sleep"]
+	_, maxSet := m["pacer_max_sleep"]
+	if !minSet && !maxSet {
+		m["pacer_min_sleep"] = "1ms"
+		m["pacer_max_sleep"] = "1ms"
+	}
+	root := m["_root"]
+	delete(m, "_root")
+	fsys, err := NewFs(context.Background(), "TestBunny", root, m)
+	require.NoError(t, err)
+	f := fsys.(*Fs)
+	f.setEndpoint(ts.URL)
+	return f
+}
+
+// testInfo returns an ObjectInfo for uploading contents to remote
+func testInfo(remote, contents string) (fs.ObjectInfo, *bytes.Reader) {
+	in := bytes.NewReader([]byte(contents))
+	info := object.NewStaticObjectInfo(remote, time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), int64(len(contents)), true, nil, nil)
+	return info, in
+}
+
+// putTestFile uploads contents to remote on f
+func putTestFile(t *testing.T, f *Fs, remote, contents string) fs.Object {
+	info, in := testInfo(remote, contents)
+	obj, err := f.Put(context.Background(), in, info)
+	require.NoError(t, err)
+	return obj
+}
+
+func TestListAndNewObject(t *testing.T) {
+	z := newTestZone()
+	z.put("file.txt", "hello")
+	z.put("dir/nested.txt", "nested")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), o.Size())
+
+	_, err = f.NewObject(ctx, "missing.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	_, err = f.NewObject(ctx, "dir")
+	assert.Equal(t, fs.ErrorIsDir, err)
+
+	sum, err := o.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	expected := sha256.Sum256([]byte("hello"))
+	assert.Equal(t, hex.EncodeToString(expected[:]), sum)
+}
+
+// TestListPathValidation checks listing entries whose Path field
+// points at a different directory are dropped with a warning.
+func TestListPathValidation(t *testing.T) {
+	z := newTestZone()
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != "GET" || !strings.HasSuffix(r.URL.Path, "/dir/") {
+			return false
+		}
+		items := []api.DirItem{
+			{ObjectName: "good.txt", Path: "/" + testZoneName + "/dir/", Length: 1, LastChanged: "2024-01-02T03:04:05.678"},
+			{ObjectName: "stray.txt", Path: "/" + testZoneName + "/other/", Length: 1, LastChanged: "2024-01-02T03:04:05.678"},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(items)
+		return true
+	}
+	f := newTestFs(t, z, nil)
+
+	var (
+		mu       sync.Mutex
+		warnings int
+	)
+	oldLogPrint := fs.LogPrint
+	fs.LogPrint = func(level fs.LogLevel, text string) {
+		if strings.Contains(text, "ignoring it") {
+			mu.Lock()
+			warnings++
+			mu.Unlock()
+		}
+	}
+	defer func() { fs.LogPrint = oldLogPrint }()
+
+	entries, err := f.List(context.Background(), "dir")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "dir/good.txt", entries[0].Remote())
+	mu.Lock()
+	assert.Equal(t, 1, warnings)
+	mu.Unlock()
+
+	// A directory whose name URL-escapes must keep its entries - the
+	// Path field holds the raw stored path, not the escaped request
+	// path, so the two only agree when compared unescaped
+	z.intercept = nil
+	z.put("my dir #100%/file.txt", "x")
+	entries, err = f.List(context.Background(), "my dir #100%")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "my dir #100%/file.txt", entries[0].Remote())
+	mu.Lock()
+	assert.Equal(t, 1, warnings)
+	mu.Unlock()
+}
+
+// TestNewObjectNestedLookup checks NewObject resolves objects at
+// every depth, and that a lookup right after an upload sees the new
+// file despite the listing cache.
+func TestNewObjectNestedLookup(t *testing.T) {
+	z := newTestZone()
+	z.put("root.txt", "r")
+	z.put("a/one.txt", "1")
+	z.put("a/b/two.txt", "22")
+	z.put("a/b/c/three.txt", "333")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	for remote, size := range map[string]int64{
+		"root.txt":        1,
+		"a/one.txt":       1,
+		"a/b/two.txt":     2,
+		"a/b/c/three.txt": 3,
+	} {
+		o, err := f.NewObject(ctx, remote)
+		require.NoError(t, err, remote)
+		assert.Equal(t, size, o.Size(), remote)
+	}
+	_, err := f.NewObject(ctx, "a/b/missing.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// The listing of a/b is now cached - an upload into it must be
+	// visible to the very next NewObject
+	putTestFile(t, f, "a/b/new.txt", "new")
+	o, err := f.NewObject(ctx, "a/b/new.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), o.Size())
+}
+
+// TestNewObjectHead checks the default NewObject path is a single
+// HEAD request building the object from the response headers, that
+// ambiguous names still fall back to the listing, and that no_head
+// restores the pure listing behaviour.
+func TestNewObjectHead(t *testing.T) {
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	newZone := func() *testZone {
+		z := newTestZone()
+		obj := z.put("dir/file.txt", "hello world")
+		obj.headers[mtimeHeader] = mtime.Format(time.RFC3339Nano)
+		return z
+	}
+	ctx := context.Background()
+
+	// Default: one HEAD, no listing, headers fully describe the object
+	z := newZone()
+	f := newTestFs(t, z, nil)
+	o, err := f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("hello world")), o.Size())
+	assert.True(t, mtime.Equal(o.ModTime(ctx)))
+	sum, err := o.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	expected := sha256.Sum256([]byte("hello world"))
+	assert.Equal(t, hex.EncodeToString(expected[:]), sum)
+	assert.Equal(t, 1, z.countRequests("HEAD /"+testZoneName+"/dir/file.txt"))
+	assert.Equal(t, 0, z.countRequests("GET /"))
+
+	// A directory name is ambiguous to HEAD - the listing fallback
+	// must still classify it, and a missing name must map cleanly
+	_, err = f.NewObject(ctx, "dir")
+	assert.Equal(t, fs.ErrorIsDir, err)
+	_, err = f.NewObject(ctx, "dir/missing.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// A warm listing cache is cheaper than any request - no HEAD then
+	z = newZone()
+	f = newTestFs(t, z, nil)
+	_, err = f.List(ctx, "dir")
+	require.NoError(t, err)
+	o, err = f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("hello world")), o.Size())
+	assert.Equal(t, 0, z.countRequests("HEAD /"))
+
+	// no_head: the lookup goes via the listing again
+	z = newZone()
+	f = newTestFs(t, z, configmap.Simple{"no_head": "true"})
+	o, err = f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("hello world")), o.Size())
+	assert.Equal(t, 0, z.countRequests("HEAD /"))
+	assert.Equal(t, 1, z.countRequests("GET /"+testZoneName+"/dir/"))
+}
+
+// TestDirListFilesAndDirs feeds a mixed listing straight into the
+// DirList accessors and checks the file/directory split: Files must
+// return exactly the non-directory items and Dirs the rest.
+func TestDirListFilesAndDirs(t *testing.T) {
+	f := newTestFs(t, newTestZone(), nil)
+	list := DirList{
+		{ObjectName: "file.txt", Length: 3, LastChanged: "2024-01-02T03:04:05.678"},
+		{ObjectName: "subdir", IsDirectory: true, LastChanged: "2024-01-02T03:04:05.678"},
+		{ObjectName: "other.bin", Length: 9, LastChanged: "2024-01-02T03:04:05.678"},
+	}
+
+	objs := list.Files(f, "dir")
+	require.Len(t, objs, 2)
+	assert.Equal(t, "dir/file.txt", objs[0].remote)
+	assert.Equal(t, "dir/other.bin", objs[1].remote)
+
+	dirs := list.Dirs(f, "dir")
+	require.Len(t, dirs, 1)
+	assert.Equal(t, "dir/subdir", dirs[0].Remote())
+}
+
+// TestListSlashObjectName checks that a listing entry whose
+// ObjectName contains a slash is treated as a nested path, with the
+// intermediate directory synthesized in the listing.
+func TestListSlashObjectName(t *testing.T) {
+	z := newTestZone()
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != "GET" || !strings.HasSuffix(r.URL.Path, "/dir/") {
+			return false
+		}
+		items := []api.DirItem{
+			{ObjectName: "plain.txt", Path: "/" + testZoneName + "/dir/", Length: 1, LastChanged: "2024-01-02T03:04:05.678"},
+			{ObjectName: "sub/nested.txt", Path: "/" + testZoneName + "/dir/", Length: 6, LastChanged: "2024-01-02T03:04:05.678"},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(items)
+		return true
+	}
+	f := newTestFs(t, z, nil)
+
+	entries, err := f.List(context.Background(), "dir")
+	require.NoError(t, err)
+	var remotes []string
+	for _, e := range entries {
+		remotes = append(remotes, e.Remote())
+	}
+	assert.ElementsMatch(t, []string{"dir/plain.txt", "dir/sub", "dir/sub/nested.txt"}, remotes)
+	for _, e := range entries {
+		switch e.Remote() {
+		case "dir/sub":
+			_, ok := e.(fs.Directory)
+			assert.True(t, ok, "dir/sub should be a directory entry")
+		case "dir/sub/nested.txt":
+			o, ok := e.(fs.Object)
+			require.True(t, ok)
+			assert.Equal(t, int64(6), o.Size())
+		}
+	}
+}
+
+func TestPutAndOpen(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	obj := putTestFile(t, f, "dir/upload.txt", "some contents")
+	assert.Equal(t, int64(13), obj.Size())
+
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "some contents", data)
+}
+
+// TestObjectID checks objects built from listing entries report the
+// server assigned Guid via ID.
+func TestObjectID(t *testing.T) {
+	z := newTestZone()
+	seeded := z.put("file.txt", "hello")
+	f := newTestFs(t, z, nil)
+
+	entries, err := f.List(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	o, ok := entries[0].(*Object)
+	require.True(t, ok)
+	assert.NotEmpty(t, o.ID())
+	assert.Equal(t, seeded.guid, o.ID())
+}
+
+// TestUploadMimeType checks uploads send a Content-Type derived from
+// the file extension and that the stored type round-trips through a
+// listing via MimeType.
+func TestUploadMimeType(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	obj := putTestFile(t, f, "site/index.html", "<html></html>")
+	assert.Contains(t, obj.(*Object).MimeType(ctx), "text/html")
+
+	z.mu.Lock()
+	stored := z.objects["site/index.html"].contentType
+	z.mu.Unlock()
+	assert.Contains(t, stored, "text/html")
+
+	// A fresh listing reports the stored type back
+	entries, err := f.List(ctx, "site")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Contains(t, entries[0].(*Object).MimeType(ctx), "text/html")
+}
+
+// TestOpenAndRemoveNotFound checks a 404 on download or delete maps
+// to the canonical fs.ErrorObjectNotFound sentinel rather than a
+// generic error, so higher level logic recognizes a missing object.
+func TestOpenAndRemoveNotFound(t *testing.T) {
+	z := newTestZone()
+	z.put("gone.txt", "soon deleted")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	o, err := f.NewObject(ctx, "gone.txt")
+	require.NoError(t, err)
+
+	// The object vanishes behind the backend's back
+	z.mu.Lock()
+	delete(z.objects, "gone.txt")
+	z.mu.Unlock()
+
+	_, err = o.Open(ctx)
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	assert.Equal(t, fs.ErrorObjectNotFound, o.Remove(ctx))
+}
+
+// TestSetModTime checks uploads record their source modtime in the
+// mtime header and SetModTime rewrites it, with lookups reflecting
+// the stored value.
+func TestSetModTime(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+	assert.Equal(t, time.Millisecond, f.Precision())
+
+	obj := putTestFile(t, f, "dir/file.txt", "contents")
+	z.mu.Lock()
+	stored := z.objects["dir/file.txt"].headers[mtimeHeader]
+	storedType := z.objects["dir/file.txt"].contentType
+	z.mu.Unlock()
+	assert.Equal(t, "2024-05-06T07:08:09Z", stored, "upload should record the source modtime")
+	require.Contains(t, storedType, "text/plain")
+
+	// Warm the listing cache so the rewrite can patch its entry
+	_, err := f.List(ctx, "dir")
+	require.NoError(t, err)
+
+	want := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, obj.SetModTime(ctx, want))
+	assert.True(t, want.Equal(obj.ModTime(ctx)))
+
+	// The rewrite must not reset the stored content type
+	z.mu.Lock()
+	assert.Equal(t, storedType, z.objects["dir/file.txt"].contentType)
+	z.mu.Unlock()
+
+	// The content survives the rewrite and a lookup sees the new
+	// modtime via the refreshed cache entry
+	o2, err := f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	assert.WithinDuration(t, want, o2.ModTime(ctx), time.Millisecond)
+	rc, err := o2.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "contents", data)
+}
+
+// TestPutReturnedObject checks the object Put hands back reports the
+// real size, modtime and the checksum that was sent with the upload.
+func TestPutReturnedObject(t *testing.T) {
+	f := newTestFs(t, newTestZone(), nil)
+	ctx := context.Background()
+
+	contents := []byte("known contents")
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	src := object.NewMemoryObject("dir/put.txt", modTime, contents)
+	o, err := f.Put(ctx, bytes.NewReader(contents), src)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(len(contents)), o.Size())
+	assert.Equal(t, modTime, o.ModTime(ctx))
+	sum, err := o.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	expected := sha256.Sum256(contents)
+	assert.Equal(t, hex.EncodeToString(expected[:]), sum)
+}
+
+func readAll(rc io.ReadCloser) (string, error) {
+	defer func() { _ = rc.Close() }()
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(rc)
+	return buf.String(), err
+}
+
+// TestTransliterate checks that names bunny can't store are stored
+// under a safe name and the original is recoverable from metadata.
+func TestTransliterate(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"transliterate": "true"})
+	ctx := context.Background()
+	const remote = "naïve file→.txt"
+	putTestFile(t, f, remote, "hello")
+
+	// Stored under the transliterated name
+	z.mu.Lock()
+	_, stored := z.objects["na_ve file_.txt"]
+	z.mu.Unlock()
+	assert.True(t, stored)
+
+	// The object is still addressable by its original name
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.Equal(t, remote, o.Remote())
+	rc, err := o.Open(ctx)
+	require.NoError(t, err)
+	contents, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", contents)
+
+	// The original name is recoverable from the stored metadata
+	meta, err := o.(fs.Metadataer).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, remote, meta["original-name"])
+}
+
+// TestAuthFailure checks a rejected access key surfaces the
+// credential hint and matches api.ErrAuthFailed so callers can detect
+// it, on both the listing and upload paths.
+func TestAuthFailure(t *testing.T) {
+	z := newTestZone()
+	z.put("file.txt", "hello")
+	f := newTestFs(t, z, configmap.Simple{"access_key": "wrong-key"})
+	ctx := context.Background()
+
+	_, err := f.List(ctx, "")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, api.ErrAuthFailed), "List: %v", err)
+	assert.Contains(t, err.Error(), "authentication failed")
+
+	info, in := testInfo("new.txt", "data")
+	_, err = f.Put(ctx, in, info)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, api.ErrAuthFailed), "Put: %v", err)
+	assert.Contains(t, err.Error(), "authentication failed")
+}
+
+// TestMkdir checks a first create succeeds and is visible to the next
+// List, and that re-creating an existing directory is a no-op even
+// when the server answers with a conflict status.
+func TestMkdir(t *testing.T) {
+	z := newTestZone()
+	z.dirs["exists"] = true
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" && (strings.HasSuffix(r.URL.Path, "/exists/") || strings.HasSuffix(r.URL.Path, "/ghost/")) {
+			writeAPIError(w, http.StatusConflict, "Directory Already Exists")
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	// Prime the root listing so the create has a cache to invalidate
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+
+	require.NoError(t, f.Mkdir(ctx, "newdir"))
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	found := false
+	for _, e := range entries {
+		if e.Remote() == "newdir" {
+			_, found = e.(fs.Directory)
+		}
+	}
+	assert.True(t, found, "List should see the new directory")
+
+	// The server refuses the duplicate create but the directory is
+	// there, so Mkdir must succeed
+	require.NoError(t, f.Mkdir(ctx, "exists"))
+
+	// A refused create of a directory which doesn't exist is an error
+	err = f.Mkdir(ctx, "ghost")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to create directory")
+}
+
+// TestEmptyDirectories checks the backend advertises
+// CanHaveEmptyDirectories and that a directory created via Mkdir
+// shows up in listings with no contents of its own.
+func TestEmptyDirectories(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	assert.True(t, f.Features().CanHaveEmptyDirectories)
+
+	require.NoError(t, f.Mkdir(ctx, "hollow"))
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	_, isDir := entries[0].(fs.Directory)
+	assert.True(t, isDir)
+	assert.Equal(t, "hollow", entries[0].Remote())
+
+	inside, err := f.List(ctx, "hollow")
+	require.NoError(t, err)
+	assert.Empty(t, inside)
+}
+
+// TestRmdir checks the documented contract: empty directories are
+// removed, non-empty ones return fs.ErrorDirectoryNotEmpty without
+// touching their contents (bunny's directory delete is recursive),
+// and missing ones map to fs.ErrorDirNotFound.
+func TestRmdir(t *testing.T) {
+	z := newTestZone()
+	z.dirs["empty"] = true
+	z.put("full/keep.txt", "precious")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	require.NoError(t, f.Rmdir(ctx, "empty"))
+	z.mu.Lock()
+	_, emptyLeft := z.dirs["empty"]
+	z.mu.Unlock()
+	assert.False(t, emptyLeft)
+
+	err := f.Rmdir(ctx, "full")
+	assert.Equal(t, fs.ErrorDirectoryNotEmpty, err)
+	z.mu.Lock()
+	_, kept := z.objects["full/keep.txt"]
+	z.mu.Unlock()
+	assert.True(t, kept, "contents must survive a refused rmdir")
+
+	err = f.Rmdir(ctx, "missing")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+}
+
+// TestEncoding checks names needing escaping round-trip: they upload,
+// list back under the same name and resolve via NewObject, while the
+// encoded form is what actually gets stored.
+func TestEncoding(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	names := []string{
+		"hash#name.txt",
+		"question?.txt",
+		"percent%20.txt",
+		"unicode-é☺.txt",
+		"back\\slash.txt",
+		" leading-space.txt",
+		"trailing-space.txt ",
+	}
+	for _, name := range names {
+		putTestFile(t, f, "dir/"+name, "data:"+name)
+	}
+
+	entries, err := f.List(ctx, "dir")
+	require.NoError(t, err)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Remote())
+	}
+	want := make([]string, len(names))
+	for i, name := range names {
+		want[i] = "dir/" + name
+	}
+	assert.ElementsMatch(t, want, got)
+
+	for _, name := range names {
+		o, err := f.NewObject(ctx, "dir/"+name)
+		require.NoError(t, err, name)
+		rc, err := o.Open(ctx)
+		require.NoError(t, err, name)
+		data, err := readAll(rc)
+		require.NoError(t, err, name)
+		assert.Equal(t, "data:"+name, data, name)
+	}
+
+	// The backslash name must have been stored in its encoded form
+	z.mu.Lock()
+	_, storedRaw := z.objects["dir/back\\slash.txt"]
+	z.mu.Unlock()
+	assert.False(t, storedRaw, "backslash name should be stored encoded")
+}
+
+// TestUploadBenchmarkCommand checks the upload-benchmark backend
+// command reports a rate and cleans up the test object.
+func TestUploadBenchmarkCommand(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	out, err := f.Command(ctx, "upload-benchmark", nil, map[string]string{"size": "4Ki,8Ki"})
+	require.NoError(t, err)
+	results, ok := out.([]benchmarkResult)
+	require.True(t, ok)
+	require.Equal(t, 2, len(results))
+	assert.Equal(t, int64(4096), results[0].Size)
+	assert.Equal(t, int64(8192), results[1].Size)
+	for _, result := range results {
+		assert.Greater(t, result.BytesPerSecond, 0.0)
+		assert.NotEmpty(t, result.Speed)
+	}
+
+	// The test object must be gone again
+	z.mu.Lock()
+	_, left := z.objects[".rclone-benchmark"]
+	z.mu.Unlock()
+	assert.False(t, left)
+
+	// Unknown commands are rejected
+	_, err = f.Command(ctx, "no-such-command", nil, nil)
+	assert.Equal(t, fs.ErrorCommandNotFound, err)
+
+	// Bad sizes are rejected up front
+	_, err = f.Command(ctx, "upload-benchmark", nil, map[string]string{"size": "potato"})
+	assert.Error(t, err)
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// TestCircuitBreaker checks the breaker opens after repeated
+// connection failures and recovers once the endpoint is back.
+func TestCircuitBreaker(t *testing.T) {
+	z := newTestZone()
+	z.put("file.txt", "hello")
+	f := newTestFs(t, z, configmap.Simple{
+		"circuit_breaker_failures": "2",
+		"circuit_breaker_cooldown": "50ms",
+	})
+	ctx := context.Background()
+
+	mt, ok := f.httpClient.Transport.(*metricsTransport)
+	require.True(t, ok)
+	bt, ok := mt.rt.(*breakerTransport)
+	require.True(t, ok)
+	working := bt.rt
+	bt.rt = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	// Two connection failures open the breaker
+	_, err := f.List(ctx, "")
+	require.Error(t, err)
+	_, err = f.List(ctx, "")
+	require.Error(t, err)
+
+	// While open requests fail fast even though the endpoint is back
+	bt.rt = working
+	_, err = f.List(ctx, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "circuit breaker open")
+
+	// After the cool-down the probe goes through and the breaker closes
+	time.Sleep(60 * time.Millisecond)
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	_, err = f.List(ctx, "")
+	require.NoError(t, err)
+}
+
+// TestDirMovePolicy checks DirMove against an overlapping destination
+// under each dir_move_policy.
+func TestDirMovePolicy(t *testing.T) {
+	newZone := func() *testZone {
+		z := newTestZone()
+		z.put("src/a.txt", "a")
+		z.put("src/sub/b.txt", "b")
+		z.put("dst/a.txt", "old")
+		z.put("dst/existing.txt", "e")
+		return z
+	}
+	contents := func(z *testZone) map[string]string {
+		z.mu.Lock()
+		defer z.mu.Unlock()
+		out := map[string]string{}
+		for name, obj := range z.objects {
+			out[name] = string(obj.data)
+		}
+		return out
+	}
+	ctx := context.Background()
+
+	// error (the default): the move is refused
+	z := newZone()
+	f := newTestFs(t, z, nil)
+	err := f.DirMove(ctx, f, "src", "dst")
+	assert.Equal(t, fs.ErrorDirExists, err)
+
+	// merge: sources relocated into the existing destination
+	z = newZone()
+	f = newTestFs(t, z, configmap.Simple{"dir_move_policy": "merge"})
+	require.NoError(t, f.DirMove(ctx, f, "src", "dst"))
+	assert.Equal(t, map[string]string{
+		"dst/a.txt":        "a",
+		"dst/existing.txt": "e",
+		"dst/sub/b.txt":    "b",
+	}, contents(z))
+
+	// replace: the existing destination is deleted first
+	z = newZone()
+	f = newTestFs(t, z, configmap.Simple{"dir_move_policy": "replace"})
+	require.NoError(t, f.DirMove(ctx, f, "src", "dst"))
+	assert.Equal(t, map[string]string{
+		"dst/a.txt":     "a",
+		"dst/sub/b.txt": "b",
+	}, contents(z))
+
+	// A fresh destination moves under the default policy
+	z = newZone()
+	f = newTestFs(t, z, nil)
+	require.NoError(t, f.DirMove(ctx, f, "src", "fresh"))
+	assert.Equal(t, map[string]string{
+		"fresh/a.txt":      "a",
+		"fresh/sub/b.txt":  "b",
+		"dst/a.txt":        "old",
+		"dst/existing.txt": "e",
+	}, contents(z))
+
+	// A missing source is reported
+	err = f.DirMove(ctx, f, "missing", "elsewhere")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+}
+
+// TestDirMoveCacheAndForeignSource checks DirMove refuses sources
+// from other remotes and leaves every affected directory cache
+// consistent after a rename.
+func TestDirMoveCacheAndForeignSource(t *testing.T) {
+	z := newTestZone()
+	z.put("src/a.txt", "a")
+	z.put("src/sub/b.txt", "b")
+	z.put("other/keep.txt", "k")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	// A source Fs on a different zone can't be moved server-side
+	foreign := &Fs{opt: Options{StorageZone: "otherzone"}}
+	err := f.DirMove(ctx, foreign, "src", "dst")
+	assert.Equal(t, fs.ErrorCantDirMove, err)
+
+	// Prime the caches of everything the move touches
+	for _, dir := range []string{"", "src", "src/sub"} {
+		_, err := f.List(ctx, dir)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, f.DirMove(ctx, f, "src", "dst"))
+
+	// The source subtree is gone, from the zone and from the caches
+	_, err = f.List(ctx, "src")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	assert.ElementsMatch(t, []string{"dst", "other"}, names)
+
+	// The destination lists the moved files
+	entries, err = f.List(ctx, "dst")
+	require.NoError(t, err)
+	names = nil
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	assert.ElementsMatch(t, []string{"dst/a.txt", "dst/sub"}, names)
+}
+
+// TestUploadManifest checks that uploads are summarized in a manifest
+// object written to the zone root on shutdown.
+func TestUploadManifest(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{
+		"_root":           "tree",
+		"upload_manifest": ".rclone-manifest.json",
+	})
+	ctx := context.Background()
+
+	putTestFile(t, f, "a.txt", "hello")
+	putTestFile(t, f, "sub/b.txt", "world!")
+	require.NoError(t, f.Shutdown(ctx))
+
+	z.mu.Lock()
+	obj, ok := z.objects[".rclone-manifest.json"]
+	z.mu.Unlock()
+	require.True(t, ok, "manifest not written to the zone root")
+
+	var entries []manifestEntry
+	require.NoError(t, json.Unmarshal(obj.data, &entries))
+	sumA := sha256.Sum256([]byte("hello"))
+	sumB := sha256.Sum256([]byte("world!"))
+	assert.Equal(t, []manifestEntry{{
+		Path:   "tree/a.txt",
+		Size:   5,
+		SHA256: hex.EncodeToString(sumA[:]),
+	}, {
+		Path:   "tree/sub/b.txt",
+		Size:   6,
+		SHA256: hex.EncodeToString(sumB[:]),
+	}}, entries)
+
+	// With the option unset nothing is written on shutdown
+	z2 := newTestZone()
+	f2 := newTestFs(t, z2, nil)
+	putTestFile(t, f2, "a.txt", "hello")
+	require.NoError(t, f2.Shutdown(ctx))
+	z2.mu.Lock()
+	_, ok = z2.objects[".rclone-manifest.json"]
+	z2.mu.Unlock()
+	assert.False(t, ok)
+}
+
+// TestUpdateFailsFast checks a permanent failure on upload is
+// reported once, with the status and server message, instead of being
+// retried until the pacer gives up.
+func TestUpdateFailsFast(t *testing.T) {
+	z := newTestZone()
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" {
+			writeAPIError(w, http.StatusForbidden, "permission denied")
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, nil)
+
+	info, in := testInfo("denied.txt", "data")
+	_, err := f.Put(context.Background(), in, info)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+	assert.Contains(t, err.Error(), "permission denied")
+	assert.Equal(t, 1, z.countRequests("PUT "), "a 403 must not be retried")
+}
+
+// TestStorageFull checks that a 507 on upload surfaces as the
+// distinct fatal storage-full error and is not retried.
+func TestStorageFull(t *testing.T) {
+	z := newTestZone()
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" {
+			writeAPIError(w, http.StatusInsufficientStorage, "Insufficient Storage")
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, nil)
+
+	info, in := testInfo("file.txt", "hello")
+	_, err := f.Put(context.Background(), in, info)
+	require.Error(t, err)
+	assert.Equal(t, errStorageFull, err)
+	assert.True(t, fserrors.IsFatalError(err))
+	assert.Equal(t, 1, z.countRequests("PUT"))
+}
+
+// countingReadCloser counts Read calls on the wrapped reader
+type countingReadCloser struct {
+	io.Reader
+	reads int
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	c.reads++
+	return c.Reader.Read(p)
+}
+
+func (c *countingReadCloser) Close() error { return nil }
+
+// TestReadBufferSize checks that small reads are served from the
+// buffer and that the option wires through to Open.
+func TestReadBufferSize(t *testing.T) {
+	data := strings.Repeat("x", 10000)
+	src := &countingReadCloser{Reader: strings.NewReader(data)}
+	brc := newBufferedReadCloser(src, 4096)
+	buf := make([]byte, 1)
+	total := 0
+	for {
+		n, err := brc.Read(buf)
+		total += n
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, len(data), total)
+	// 10000 bytes through a 4096 byte buffer needs ~3 fills, not 10000
+	assert.LessOrEqual(t, src.reads, 4)
+	require.NoError(t, brc.Close())
+
+	z := newTestZone()
+	z.put("file.txt", "hello")
+	ctx := context.Background()
+
+	// Buffered when a size is set
+	f := newTestFs(t, z, configmap.Simple{"read_buffer_size": "64Ki"})
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	rc, err := o.Open(ctx)
+	require.NoError(t, err)
+	_, buffered := rc.(*bufferedReadCloser)
+	assert.True(t, buffered)
+	contents, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", contents)
+
+	// read_buffer_size=0 reads straight from the response body
+	f = newTestFs(t, z, configmap.Simple{"read_buffer_size": "0"})
+	o, err = f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	rc, err = o.Open(ctx)
+	require.NoError(t, err)
+	_, buffered = rc.(*bufferedReadCloser)
+	assert.False(t, buffered)
+	contents, err = readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", contents)
+}
+
+// TestWriteBufferSize checks that dribbling sources are coalesced
+// into full buffers and upload correctly.
+func TestWriteBufferSize(t *testing.T) {
+	data := strings.Repeat("0123456789", 1000)
+
+	// The buffered reader hands out full buffers even when the source
+	// produces one byte per read
+	br := newBufferedUploadReader(iotest.OneByteReader(strings.NewReader(data)), 4096)
+	buf := make([]byte, 8192)
+	n, err := br.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 4096, n)
+	remaining, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(buf[:n])+string(remaining))
+
+	// An upload from a dribbling source is complete and correct
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"write_buffer_size": "4Ki"})
+	info, _ := testInfo("file.txt", data)
+	_, err = f.Put(context.Background(), iotest.OneByteReader(strings.NewReader(data)), info)
+	require.NoError(t, err)
+	z.mu.Lock()
+	stored := string(z.objects["file.txt"].data)
+	z.mu.Unlock()
+	assert.Equal(t, data, stored)
+}
+
+// TestTruncatedListing checks that a truncated JSON listing is
+// retried rather than returned as a partial result.
+func TestTruncatedListing(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "a")
+	z.put("b.txt", "b")
+	truncated := 0
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/") && truncated < 2 {
+			truncated++
+			// Cut off mid-entry - valid Content-Length, invalid JSON
+			_, _ = w.Write([]byte(`[{"ObjectName": "a.tx`))
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, nil)
+
+	entries, err := f.List(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, 2, truncated, "truncated responses should have been retried")
+}
+
+// TestDecodeListing checks the streaming listing decoder handles a
+// well formed array and flags truncation at every point: mid-entry,
+// between entries and before the closing bracket.
+func TestDecodeListing(t *testing.T) {
+	good := `[{"ObjectName": "a.txt", "Length": 1}, {"ObjectName": "b", "IsDirectory": true}]`
+	list, err := decodeListing(strings.NewReader(good))
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "a.txt", list[0].ObjectName)
+	assert.True(t, list[1].IsDirectory)
+
+	for _, empty := range []string{"[]", "null"} {
+		list, err = decodeListing(strings.NewReader(empty))
+		require.NoError(t, err, "input %q", empty)
+		assert.Empty(t, list, "input %q", empty)
+	}
+
+	for _, bad := range []string{
+		``,
+		`{"ObjectName": "not-an-array"}`,
+		`[{"ObjectName": "a.tx`,
+		`[{"ObjectName": "a.txt"},`,
+		`[{"ObjectName": "a.txt"}`,
+	} {
+		_, err := decodeListing(strings.NewReader(bad))
+		assert.Error(t, err, "input %q", bad)
+	}
+}
+
+// BenchmarkDecodeListing measures the streaming decoder on a large
+// synthetic listing - compare against BenchmarkUnmarshalListing which
+// buffers the body the way list() used to.
+func BenchmarkDecodeListing(b *testing.B) {
+	payload := syntheticListing(b, 10000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		list, err := decodeListing(bytes.NewReader(payload))
+		if err != nil || len(list) != 10000 {
+			b.Fatalf("decode failed: %v (%d entries)", err, len(list))
+		}
+	}
+}
+
+// BenchmarkUnmarshalListing is the buffered baseline for
+// BenchmarkDecodeListing.
+func BenchmarkUnmarshalListing(b *testing.B) {
+	payload := syntheticListing(b, 10000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var list DirList
+		if err := json.Unmarshal(payload, &list); err != nil || len(list) != 10000 {
+			b.Fatalf("decode failed: %v (%d entries)", err, len(list))
+		}
+	}
+}
+
+// syntheticListing marshals a listing of n generated entries.
+func syntheticListing(tb testing.TB, n int) []byte {
+	list := make(DirList, n)
+	for i := range list {
+		list[i] = api.DirItem{
+			Guid:        fmt.Sprintf("guid-%08d", i),
+			ObjectName:  fmt.Sprintf("file-%08d.txt", i),
+			Length:      int64(i),
+			LastChanged: "2024-01-02T03:04:05.678",
+		}
+	}
+	payload, err := json.Marshal(list)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return payload
+}
+
+// TestListCacheDir checks that a listing persisted by one Fs instance
+// is reused by a second instance within the TTL.
+func TestListCacheDir(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "a")
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	f1 := newTestFs(t, z, configmap.Simple{"list_cache_dir": cacheDir})
+	entries, err := f1.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	// A second instance must serve the listing from disk without
+	// touching the network
+	listings := z.countRequests("GET")
+	f2 := newTestFs(t, z, configmap.Simple{"list_cache_dir": cacheDir})
+	entries, err = f2.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, listings, z.countRequests("GET"))
+
+	// A different root must not see the other root's entries
+	f3 := newTestFs(t, z, configmap.Simple{"list_cache_dir": cacheDir, "_root": "sub"})
+	_, err = f3.List(ctx, "")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+
+	// Expired entries are refetched
+	f2.cache.mu.Lock()
+	f2.cache.ttl = time.Nanosecond
+	f2.cache.mu.Unlock()
+	_, err = f2.List(ctx, "")
+	require.NoError(t, err)
+	assert.Greater(t, z.countRequests("GET"), listings)
+
+	// A rooted remote must reuse its persisted cache too - the root
+	// file probe in NewFs must not wipe the disk entries
+	z.put("tree/b.txt", "b")
+	f4 := newTestFs(t, z, configmap.Simple{"list_cache_dir": cacheDir, "_root": "tree"})
+	_, err = f4.List(ctx, "")
+	require.NoError(t, err)
+	treeListings := z.countRequests("GET /" + testZoneName + "/tree/")
+	f5 := newTestFs(t, z, configmap.Simple{"list_cache_dir": cacheDir, "_root": "tree"})
+	entries, err = f5.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, treeListings, z.countRequests("GET /"+testZoneName+"/tree/"))
+}
+
+// TestListCacheTime checks listings are reused from cache within
+// list_cache_time and that a TTL of 0 disables caching.
+func TestListCacheTime(t *testing.T) {
+	z := newTestZone()
+	z.put("dir/a.txt", "a")
+	ctx := context.Background()
+
+	f := newTestFs(t, z, configmap.Simple{"list_cache_time": "1h"})
+	_, err := f.List(ctx, "dir")
+	require.NoError(t, err)
+	listings := z.countRequests("GET /" + testZoneName + "/dir/")
+	_, err = f.List(ctx, "dir")
+	require.NoError(t, err)
+	_, err = f.NewObject(ctx, "dir/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, listings, z.countRequests("GET /"+testZoneName+"/dir/"), "lookups within the TTL should not refetch the listing")
+
+	// Writing into the directory keeps the cached listing coherent
+	// (via the targeted refresh) without refetching it
+	putTestFile(t, f, "dir/b.txt", "b")
+	entries, err := f.List(ctx, "dir")
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, listings, z.countRequests("GET /"+testZoneName+"/dir/"))
+
+	// A TTL of 0 disables the cache entirely
+	f = newTestFs(t, z, configmap.Simple{"list_cache_time": "0s"})
+	before := z.countRequests("GET /" + testZoneName + "/dir/")
+	_, err = f.List(ctx, "dir")
+	require.NoError(t, err)
+	_, err = f.List(ctx, "dir")
+	require.NoError(t, err)
+	assert.Equal(t, before+2, z.countRequests("GET /"+testZoneName+"/dir/"))
+}
+
+// TestListConcurrency checks list_concurrency bounds how many listing
+// fetches are in flight at once.
+func TestListConcurrency(t *testing.T) {
+	z := newTestZone()
+	for i := 0; i < 6; i++ {
+		z.put(fmt.Sprintf("dir%d/f.txt", i), "x")
+	}
+	var inflight, maxInflight int64
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != "GET" || !strings.HasSuffix(r.URL.Path, "/") {
+			return false
+		}
+		n := atomic.AddInt64(&inflight, 1)
+		for {
+			m := atomic.LoadInt64(&maxInflight)
+			if n <= m || atomic.CompareAndSwapInt64(&maxInflight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt64(&inflight, -1)
+		return false
+	}
+	f := newTestFs(t, z, configmap.Simple{"list_concurrency": "2", "list_cache_time": "0s"})
+
+	errs := make(chan error, 6)
+	for i := 0; i < 6; i++ {
+		go func(i int) {
+			_, err := f.List(context.Background(), fmt.Sprintf("dir%d", i))
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.LessOrEqual(t, atomic.LoadInt64(&maxInflight), int64(2), "no more than list_concurrency listings should be in flight")
+	assert.Greater(t, atomic.LoadInt64(&maxInflight), int64(0))
+}
+
+// TestListRCycle checks ListR terminates when the listings contain a
+// cyclic directory reference.
+func TestListRCycle(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "a")
+	z.mu.Lock()
+	z.dirs["loop"] = true
+	z.mu.Unlock()
+	// Every listing under loop/ returns the same directory entry with
+	// the same Guid, referencing itself
+	cycle, err := json.Marshal([]api.DirItem{{
+		Guid:        "cycle-guid",
+		ObjectName:  "self",
+		IsDirectory: true,
+		LastChanged: "2024-01-02T03:04:05",
+	}})
+	require.NoError(t, err)
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && strings.Contains(r.URL.Path, "/loop") && strings.HasSuffix(r.URL.Path, "/") {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(cycle)
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, nil)
+
+	var remotes []string
+	err = f.ListR(context.Background(), "", func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			remotes = append(remotes, entry.Remote())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(remotes)
+	assert.Equal(t, []string{"a.txt", "loop", "loop/self", "loop/self/self"}, remotes)
+}
+
+// TestListRConcurrent checks the recursive walk fans out listing
+// requests in parallel, bounded by --checkers, and still delivers the
+// complete tree.
+func TestListRConcurrent(t *testing.T) {
+	z := newTestZone()
+	var want []string
+	for i := 0; i < 9; i++ {
+		z.put(fmt.Sprintf("dir%d/f.txt", i), "x")
+		want = append(want, fmt.Sprintf("dir%d", i), fmt.Sprintf("dir%d/f.txt", i))
+	}
+	var inflight, maxInflight int64
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != "GET" || !strings.HasSuffix(r.URL.Path, "/") {
+			return false
+		}
+		n := atomic.AddInt64(&inflight, 1)
+		for {
+			m := atomic.LoadInt64(&maxInflight)
+			if n <= m || atomic.CompareAndSwapInt64(&maxInflight, m, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		atomic.AddInt64(&inflight, -1)
+		return false
+	}
+	f := newTestFs(t, z, configmap.Simple{"list_cache_time": "0s"})
+
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Checkers = 3
+	var mu sync.Mutex
+	var remotes []string
+	err := f.ListR(ctx, "", func(entries fs.DirEntries) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, entry := range entries {
+			remotes = append(remotes, entry.Remote())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(remotes)
+	sort.Strings(want)
+	assert.Equal(t, want, remotes)
+	assert.LessOrEqual(t, atomic.LoadInt64(&maxInflight), int64(3), "walk must respect --checkers")
+	assert.Greater(t, atomic.LoadInt64(&maxInflight), int64(1), "walk should list directories in parallel")
+}
+
+// TestMetricsHook checks the hook sees accurate metrics for a
+// sequence of operations.
+func TestMetricsHook(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	byOp := map[string][]Metric{}
+	f.SetMetricsHook(func(m Metric) {
+		mu.Lock()
+		defer mu.Unlock()
+		byOp[m.Operation] = append(byOp[m.Operation], m)
+	})
+
+	obj := putTestFile(t, f, "file.txt", "hello")
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+	rc, err := obj.(*Object).Open(ctx)
+	require.NoError(t, err)
+	_, err = readAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, obj.Remove(ctx))
+
+	// The hook runs on its own goroutine so wait for everything
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(byOp["upload"]) >= 1 && len(byOp["list"]) >= 1 &&
+			len(byOp["download"]) >= 1 && len(byOp["delete"]) >= 1
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	upload := byOp["upload"][0]
+	assert.Equal(t, http.StatusCreated, upload.Status)
+	assert.Equal(t, int64(5), upload.Bytes)
+	assert.Greater(t, upload.Duration, time.Duration(0))
+	download := byOp["download"][0]
+	assert.Equal(t, http.StatusOK, download.Status)
+	assert.Equal(t, int64(5), download.Bytes)
+	assert.Equal(t, http.StatusOK, byOp["list"][0].Status)
+	assert.Equal(t, http.StatusOK, byOp["delete"][0].Status)
+}
+
+// TestNameCollisionPolicy checks resolution of a name which is both a
+// file and a directory under each policy.
+func TestNameCollisionPolicy(t *testing.T) {
+	z := newTestZone()
+	z.put("foo", "file contents")
+	z.put("foo/inner.txt", "inner")
+	ctx := context.Background()
+
+	// prefer-file (the default): the file wins
+	f := newTestFs(t, z, nil)
+	o, err := f.NewObject(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("file contents")), o.Size())
+
+	// prefer-dir: treated as a directory
+	f = newTestFs(t, z, configmap.Simple{"name_collision_policy": "prefer-dir"})
+	_, err = f.NewObject(ctx, "foo")
+	assert.Equal(t, fs.ErrorIsDir, err)
+
+	// error: the ambiguity is refused
+	f = newTestFs(t, z, configmap.Simple{"name_collision_policy": "error"})
+	_, err = f.NewObject(ctx, "foo")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "both a file and a directory")
+
+	// No collision resolves normally whatever the policy
+	o, err = f.NewObject(ctx, "foo/inner.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), o.Size())
+}
+
+// TestTargetedCacheRefresh checks that updating one object patches
+// just its entry in the cached listing instead of invalidating the
+// whole directory.
+func TestTargetedCacheRefresh(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "aaa")
+	z.put("b.txt", "bbb")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	// Prime the cache and remember b's entry
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+	cached, ok := f.cache.Get("")
+	require.True(t, ok)
+	findItem := func(list DirList, leaf string) *api.DirItem {
+		for i := range list {
+			if list[i].ObjectName == leaf {
+				return &list[i]
+			}
+		}
+		return nil
+	}
+	oldB := findItem(cached, "b.txt")
+	require.NotNil(t, oldB)
+
+	obj, err := f.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+	newContents := "AAAA"
+	src := object.NewStaticObjectInfo("a.txt", time.Now(), int64(len(newContents)), true, nil, nil)
+	require.NoError(t, obj.Update(ctx, strings.NewReader(newContents), src))
+
+	// The cache wasn't invalidated: only a's entry changed
+	cached, ok = f.cache.Get("")
+	require.True(t, ok, "cached listing should have survived the update")
+	newA := findItem(cached, "a.txt")
+	require.NotNil(t, newA)
+	assert.Equal(t, int64(len(newContents)), newA.Length)
+	sum := sha256.Sum256([]byte(newContents))
+	assert.Equal(t, strings.ToUpper(hex.EncodeToString(sum[:])), newA.Checksum)
+	assert.Equal(t, *oldB, *findItem(cached, "b.txt"))
+
+	// The refresh was a single HEAD, not a relisting - the only GET
+	// was the priming listing
+	assert.Equal(t, 1, z.countRequests("HEAD /testzone/a.txt"))
+	assert.Equal(t, 1, z.countRequests("GET /testzone/"))
+}
+
+// TestChecksumManifest checks uploads with no source hash send the
+// checksum supplied by a checksum_manifest file.
+func TestChecksumManifest(t *testing.T) {
+	z := newTestZone()
+	contents := "restored content"
+	sum := sha256.Sum256([]byte(contents))
+	manifest, err := json.Marshal([]manifestEntry{{
+		Path:   "file.txt",
+		Size:   int64(len(contents)),
+		SHA256: hex.EncodeToString(sum[:]),
+	}})
+	require.NoError(t, err)
+	manifestFile := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(manifestFile, manifest, 0o600))
+
+	var checksumHeader string
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" {
+			checksumHeader = r.Header.Get("Checksum")
+		}
+		return false
+	}
+	f := newTestFs(t, z, configmap.Simple{"checksum_manifest": manifestFile})
+	ctx := context.Background()
+	// The source supplies no hash - the manifest checksum must be used
+	src := object.NewStaticObjectInfo("file.txt", time.Now(), int64(len(contents)), true, nil, nil)
+	_, err = f.Put(ctx, strings.NewReader(contents), src)
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToUpper(hex.EncodeToString(sum[:])), checksumHeader)
+}
+
+// TestTruncatedChecksum checks that an implausible checksum in a
+// listing is treated as unavailable rather than stored.
+func TestTruncatedChecksum(t *testing.T) {
+	z := newTestZone()
+	badList, err := json.Marshal([]api.DirItem{{
+		Guid:        "guid-1",
+		Path:        "/" + testZoneName + "/",
+		ObjectName:  "file.txt",
+		Length:      5,
+		LastChanged: "2024-01-02T03:04:05.678",
+		// Truncated by an intermediary - not 64 hex chars
+		Checksum: "AF2BDBE1AA9B",
+	}})
+	require.NoError(t, err)
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/") {
+			_, _ = w.Write(badList)
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, nil)
+	obj, err := f.NewObject(context.Background(), "file.txt")
+	require.NoError(t, err)
+	sum, err := obj.Hash(context.Background(), hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, "", sum, "truncated checksum should be dropped")
+}
+
+// TestExportCommand checks the export command writes a tar archive of
+// the remote's contents in sorted order.
+func TestExportCommand(t *testing.T) {
+	z := newTestZone()
+	z.put("b.txt", "contents of b")
+	z.put("a.txt", "contents of a")
+	z.put("sub/c.txt", "contents of c")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+	target := filepath.Join(t.TempDir(), "export.tar")
+
+	out, err := f.Command(ctx, "export", nil, map[string]string{"target": target})
+	require.NoError(t, err)
+	result, ok := out.(exportResult)
+	require.True(t, ok)
+	assert.Equal(t, 3, result.Files)
+	assert.Equal(t, int64(len("contents of x")*3), result.Bytes)
+
+	archive, err := os.Open(target)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, archive.Close()) }()
+	tr := tar.NewReader(archive)
+	var names []string
+	contents := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		contents[hdr.Name] = string(data)
+	}
+	assert.Equal(t, []string{"a.txt", "b.txt", "sub/c.txt"}, names)
+	assert.Equal(t, "contents of a", contents["a.txt"])
+	assert.Equal(t, "contents of b", contents["b.txt"])
+	assert.Equal(t, "contents of c", contents["sub/c.txt"])
+}
+
+// TestCopyCheckpoint checks a resumed copy skips uploads recorded in
+// the checkpoint file and redoes ones whose content changed.
+func TestCopyCheckpoint(t *testing.T) {
+	z := newTestZone()
+	checkpoint := filepath.Join(t.TempDir(), "copy.checkpoint")
+	opts := configmap.Simple{"copy_checkpoint": checkpoint}
+	f := newTestFs(t, z, opts)
+	ctx := context.Background()
+
+	contents := "checkpointed contents"
+	sum := sha256.Sum256([]byte(contents))
+	hashes := map[hash.Type]string{hash.SHA256: hex.EncodeToString(sum[:])}
+	put := func(f *Fs) {
+		src := object.NewStaticObjectInfo("file.txt", time.Now(), int64(len(contents)), true, hashes, nil)
+		_, err := f.Put(ctx, strings.NewReader(contents), src)
+		require.NoError(t, err)
+	}
+
+	put(f)
+	assert.Equal(t, 1, z.countRequests("PUT /testzone/file.txt"))
+
+	// A resumed run - a fresh Fs on the same checkpoint - skips the
+	// completed upload
+	f2 := newTestFs(t, z, opts)
+	put(f2)
+	assert.Equal(t, 1, z.countRequests("PUT /testzone/file.txt"))
+
+	// Changed content no longer matches the recorded checksum and is
+	// uploaded again
+	changed := "different contents"
+	changedSum := sha256.Sum256([]byte(changed))
+	src := object.NewStaticObjectInfo("file.txt", time.Now(), int64(len(changed)), true,
+		map[hash.Type]string{hash.SHA256: hex.EncodeToString(changedSum[:])}, nil)
+	_, err := f2.Put(ctx, strings.NewReader(changed), src)
+	require.NoError(t, err)
+	assert.Equal(t, 2, z.countRequests("PUT /testzone/file.txt"))
+	assert.Equal(t, changed, string(z.objects["file.txt"].data))
+}
+
+// TestDeleteWait checks Remove polls a lingering object until its
+// deletion becomes visible when delete_wait is set.
+func TestDeleteWait(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "going away")
+	f := newTestFs(t, z, configmap.Simple{"delete_wait": "5s"})
+	ctx := context.Background()
+
+	o, err := f.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+
+	// The first post-delete HEAD pretends the deletion hasn't
+	// propagated yet
+	var heads int32
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "HEAD" && strings.HasSuffix(r.URL.Path, "/a.txt") {
+			if atomic.AddInt32(&heads, 1) == 1 {
+				w.Header().Set("Content-Length", "10")
+				w.WriteHeader(http.StatusOK)
+				return true
+			}
+		}
+		return false
+	}
+
+	start := time.Now()
+	require.NoError(t, o.Remove(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond, "Remove should wait out the lingering object")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&heads), "Remove should poll until the object is gone")
+	_, err = f.NewObject(ctx, "a.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
+
+// TestCopy checks a plain copy streams within the zone with the
+// checksum sent for server-side validation, returns a fully populated
+// object, and refuses sources from other remotes.
+func TestCopy(t *testing.T) {
+	z := newTestZone()
+	contents := "copy me"
+	z.put("a.txt", contents)
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	var checksumHeader string
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" {
+			checksumHeader = r.Header.Get("Checksum")
+		}
+		return false
+	}
+
+	src, err := f.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+	srcSum, err := src.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+
+	copied, err := f.Copy(ctx, src, "b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "b.txt", copied.Remote())
+	assert.Equal(t, int64(len(contents)), copied.Size())
+	assert.False(t, copied.ModTime(ctx).IsZero())
+	copiedSum, err := copied.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, srcSum, copiedSum)
+	assert.Equal(t, strings.ToUpper(srcSum), checksumHeader, "the PUT should carry the checksum for server-side validation")
+	assert.Equal(t, contents, string(z.objects["b.txt"].data))
+	_, err = f.NewObject(ctx, "a.txt")
+	assert.NoError(t, err, "the source should survive a copy")
+
+	// A source from another remote can't be copied server-side
+	foreign := object.NewMemoryObject("c.txt", time.Now(), []byte("foreign"))
+	_, err = f.Copy(ctx, foreign, "c.txt")
+	assert.Equal(t, fs.ErrorCantCopy, err)
+}
+
+// TestCopyDedup checks Copy skips the data transfer when the
+// destination already holds identical content, and still streams the
+// object when it doesn't.
+func TestCopyDedup(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "identical contents")
+	z.put("b.txt", "identical contents")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	src, err := f.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+
+	// The destination already has the same content - no data moves
+	dst, err := f.Copy(ctx, src, "b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "b.txt", dst.Remote())
+	assert.Equal(t, 0, z.countRequests("GET /testzone/a.txt"), "dedup copy shouldn't read the source")
+	assert.Equal(t, 0, z.countRequests("PUT "), "dedup copy shouldn't upload anything")
+
+	// A missing destination still gets a full copy
+	dst, err = f.Copy(ctx, src, "c.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "c.txt", dst.Remote())
+	assert.Equal(t, 1, z.countRequests("GET /testzone/a.txt"))
+	assert.Equal(t, 1, z.countRequests("PUT /testzone/c.txt"))
+	assert.Equal(t, "identical contents", string(z.objects["c.txt"].data))
+}
+
+// TestListRetryOnEmpty checks a listing which omits a just-written
+// object is re-fetched when list_retry_on_empty is set.
+func TestListRetryOnEmpty(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"list_retry_on_empty": "2"})
+	ctx := context.Background()
+
+	// The first listing pretends the zone hasn't caught up with the
+	// upload yet
+	var listCalls int32
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/") {
+			if atomic.AddInt32(&listCalls, 1) == 1 {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte("[]"))
+				return true
+			}
+		}
+		return false
+	}
+
+	contents := "freshly written"
+	src := object.NewStaticObjectInfo("file.txt", time.Now(), int64(len(contents)), true, nil, nil)
+	_, err := f.Put(ctx, strings.NewReader(contents), src)
+	require.NoError(t, err)
+
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	assert.Contains(t, names, "file.txt", "retried listing should include the new object")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&listCalls), "the empty listing should have been re-fetched once")
+}
+
+// TestSerializeSamePath checks concurrent Puts to the same path are
+// serialized client-side when serialize_same_path is set.
+func TestSerializeSamePath(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"serialize_same_path": "true"})
+	ctx := context.Background()
+
+	var inflight, maxInflight int32
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" {
+			n := atomic.AddInt32(&inflight, 1)
+			for {
+				seen := atomic.LoadInt32(&maxInflight)
+				if n <= seen || atomic.CompareAndSwapInt32(&maxInflight, seen, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&inflight, -1)
+		}
+		return false
+	}
+
+	payloads := []string{strings.Repeat("a", 100), strings.Repeat("b", 100)}
+	var wg sync.WaitGroup
+	for _, contents := range payloads {
+		contents := contents
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			src := object.NewStaticObjectInfo("file.txt", time.Now(), int64(len(contents)), true, nil, nil)
+			_, err := f.Put(ctx, strings.NewReader(contents), src)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), maxInflight, "uploads to the same path should not overlap")
+
+	// The final state is whichever write finished last, and the cached
+	// listing agrees with it
+	stored := string(z.objects["file.txt"].data)
+	assert.Contains(t, payloads, stored)
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(stored)), o.Size())
+}
+
+// TestStripPrefix checks strip_prefix re-roots listings below the
+// prefix while operations still target the full stored path.
+func TestStripPrefix(t *testing.T) {
+	z := newTestZone()
+	z.put("deep/base/a.txt", "contents of a")
+	z.put("deep/base/sub/b.txt", "contents of b")
+	z.put("other.txt", "outside the prefix")
+	f := newTestFs(t, z, configmap.Simple{"strip_prefix": "/deep/base/"})
+	ctx := context.Background()
+
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	assert.ElementsMatch(t, []string{"a.txt", "sub"}, names)
+
+	// Round trip through NewObject and Open under the stripped name
+	o, err := f.NewObject(ctx, "sub/b.txt")
+	require.NoError(t, err)
+	rc, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "contents of b", string(data))
+	assert.Equal(t, 1, z.countRequests("GET /testzone/deep/base/sub/b.txt"), "read should target the full path")
+
+	// Writes land under the prefix too
+	contents := "new contents"
+	src := object.NewStaticObjectInfo("new.txt", time.Now(), int64(len(contents)), true, nil, nil)
+	_, err = f.Put(ctx, strings.NewReader(contents), src)
+	require.NoError(t, err)
+	_, stored := z.objects["deep/base/new.txt"]
+	assert.True(t, stored, "upload should land under the prefix")
+
+	// Objects outside the prefix are invisible
+	_, err = f.NewObject(ctx, "other.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
+
+// TestRawCommand checks the raw debugging command issues exactly the
+// request specified and returns the response.
+func TestRawCommand(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "raw contents")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	out, err := f.Command(ctx, "raw", []string{"get", "/testzone/a.txt"}, nil)
+	require.NoError(t, err)
+	result, ok := out.(rawResult)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusOK, result.Status)
+	assert.Equal(t, "raw contents", result.Body)
+	assert.Equal(t, 1, z.countRequests("GET /testzone/a.txt"))
+
+	// A body goes through verbatim
+	out, err = f.Command(ctx, "raw", []string{"PUT", "/testzone/new.txt"}, map[string]string{"body": "written raw"})
+	require.NoError(t, err)
+	result = out.(rawResult)
+	assert.Equal(t, http.StatusCreated, result.Status)
+	assert.Equal(t, "written raw", string(z.objects["new.txt"].data))
+
+	// Errors come back as the raw status, not as Go errors
+	out, err = f.Command(ctx, "raw", []string{"GET", "/testzone/missing.txt"}, nil)
+	require.NoError(t, err)
+	result = out.(rawResult)
+	assert.Equal(t, http.StatusNotFound, result.Status)
+
+	_, err = f.Command(ctx, "raw", []string{"GET"}, nil)
+	require.Error(t, err)
+}
+
+// TestHealthCheckCommand checks the health-check command probes every
+// endpoint and ranks the report fastest first with failures last.
+func TestHealthCheckCommand(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	stub := func(delay time.Duration, status int) *httptest.Server {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte("[]"))
+		}))
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	slow := stub(150*time.Millisecond, http.StatusOK)
+	medium := stub(50*time.Millisecond, http.StatusOK)
+	broken := stub(0, http.StatusInternalServerError)
+
+	out, err := f.Command(ctx, "health-check", nil, map[string]string{
+		"endpoints": strings.Join([]string{slow.URL, medium.URL, broken.URL}, ","),
+		"count":     "1",
+	})
+	require.NoError(t, err)
+	results, ok := out.([]healthResult)
+	require.True(t, ok)
+	require.Len(t, results, 4)
+	assert.Equal(t, f.endpoint, results[0].Endpoint, "configured endpoint should be fastest")
+	assert.Equal(t, medium.URL, results[1].Endpoint)
+	assert.Equal(t, slow.URL, results[2].Endpoint)
+	for _, res := range results[:3] {
+		assert.Equal(t, "ok", res.Status, res.Endpoint)
+	}
+	assert.Less(t, results[1].Millis, results[2].Millis)
+	assert.Equal(t, broken.URL, results[3].Endpoint, "failing endpoint should rank last")
+	assert.NotEqual(t, "ok", results[3].Status)
+	assert.Equal(t, http.StatusInternalServerError, results[3].Code)
+
+	_, err = f.Command(ctx, "health-check", nil, map[string]string{"count": "zero"})
+	require.Error(t, err)
+}
+
+// TestAllowRootPurge checks purging the zone root is refused unless
+// allow_root_purge is set.
+func TestAllowRootPurge(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "aaa")
+	z.put("sub/b.txt", "bbb")
+	ctx := context.Background()
+
+	f := newTestFs(t, z, nil)
+	err := f.Purge(ctx, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "allow_root_purge")
+	_, err = f.NewObject(ctx, "a.txt")
+	assert.NoError(t, err, "refused purge shouldn't have deleted anything")
+
+	// A non-root purge needs no flag
+	require.NoError(t, f.Purge(ctx, "sub"))
+
+	// With the flag set the root purge goes ahead
+	f = newTestFs(t, z, configmap.Simple{"allow_root_purge": "true"})
+	require.NoError(t, f.Purge(ctx, ""))
+	_, err = f.NewObject(ctx, "a.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
+
+// TestPackSmallFiles checks small uploads are batched into pack
+// objects and read back individually, both before and after the packs
+// are flushed to the zone.
+func TestPackSmallFiles(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"pack_small_files": "1Ki"})
+	ctx := context.Background()
+
+	files := map[string]string{
+		"a.txt":     "contents of a",
+		"b.txt":     "contents of b",
+		"sub/c.txt": "contents of c",
+	}
+	readBack := func(f fs.Fs, name, want string) {
+		t.Helper()
+		obj, err := f.NewObject(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(want)), obj.Size())
+		rc, err := obj.Open(ctx)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, want, string(data))
+	}
+
+	for name, contents := range files {
+		src := object.NewStaticObjectInfo(name, time.Now(), int64(len(contents)), true, nil, nil)
+		obj, err := f.Put(ctx, strings.NewReader(contents), src)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(contents)), obj.Size())
+	}
+	// Each Put rewrote its directory's pack synchronously - the data
+	// is durable before Put reports success - and the directory's
+	// files share one pack object which grows in place
+	assert.Equal(t, 2, z.countRequests("PUT /testzone/.rclone-pack-"))
+	assert.Equal(t, 1, z.countRequests("PUT /testzone/sub/.rclone-pack-"))
+	for name, contents := range files {
+		readBack(f, name, contents)
+	}
+
+	// Shutdown has nothing left to flush
+	require.NoError(t, f.Shutdown(ctx))
+	assert.Equal(t, 2, z.countRequests("PUT /testzone/.rclone-pack-"))
+	assert.Equal(t, 1, z.countRequests("PUT /testzone/sub/.rclone-pack-"))
+
+	// A fresh Fs reads each file back out of the stored packs
+	f2 := newTestFs(t, z, configmap.Simple{"pack_small_files": "1Ki"})
+	for name, contents := range files {
+		readBack(f2, name, contents)
+	}
+
+	// Listings show the packed files, never the pack objects
+	entries, err := f2.List(ctx, "")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	assert.ElementsMatch(t, []string{"a.txt", "b.txt", "sub"}, names)
+
+	// Removing a packed file rewrites its pack without it
+	obj, err := f2.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+	require.NoError(t, obj.Remove(ctx))
+	_, err = f2.NewObject(ctx, "a.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	readBack(f2, "b.txt", "contents of b")
+}
+
+// TestRegionMetadata checks the serving region and replicated zones
+// are surfaced in object metadata.
+func TestRegionMetadata(t *testing.T) {
+	z := newTestZone()
+	z.replicatedZones = "DE,NY"
+	z.put("file.txt", "hello")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+	obj, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	meta, err := obj.(*Object).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "DE", meta["region"])
+	assert.Equal(t, "DE,NY", meta["replicated-zones"])
+}
+
+// TestPacerOptions checks custom pacer timings reach the pacer - with
+// a large pacer_min_sleep two consecutive API calls are spaced at
+// least that far apart - and that min above max is refused.
+func TestPacerOptions(t *testing.T) {
+	z := newTestZone()
+	z.put("a/x.txt", "x")
+	z.put("b/y.txt", "y")
+	f := newTestFs(t, z, configmap.Simple{
+		"pacer_min_sleep": "200ms",
+		"list_cache_time": "0s",
+	})
+	ctx := context.Background()
+
+	start := time.Now()
+	_, err := f.List(ctx, "a")
+	require.NoError(t, err)
+	_, err = f.List(ctx, "b")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	_, err = NewFs(ctx, "TestBunny", "", configmap.Simple{
+		"storage_zone":    testZoneName,
+		"access_key":      testAccessKey,
+		"pacer_min_sleep": "2s",
+		"pacer_max_sleep": "1s",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pacer_min_sleep")
+}
+
+// TestConsolidatedClient checks listings (issued via the rest client)
+// and raw transfers run over the same underlying HTTP client, so
+// transport tuning and the AccessKey header apply to both paths.
+func TestConsolidatedClient(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "aaa")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	base := f.httpClient.Transport
+	f.httpClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		keys = append(keys, req.Header.Get("AccessKey"))
+		mu.Unlock()
+		return base.RoundTrip(req)
+	})
+
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+	putTestFile(t, f, "b.txt", "bbb")
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.GreaterOrEqual(t, len(keys), 2, "both the listing and the upload should cross the shared transport")
+	for _, k := range keys {
+		assert.Equal(t, testAccessKey, k)
+	}
+}
+
+// TestSharedTransport checks that the listing and transfer paths
+// share one tuned transport when the pool options are set.
+func TestSharedTransport(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{
+		"max_idle_conns":    "8",
+		"idle_conn_timeout": "30s",
+	})
+	// One client for both the rest.Client and direct transfers
+	assert.Same(t, f.httpClient, f.readClient)
+	mt, ok := f.httpClient.Transport.(*metricsTransport)
+	require.True(t, ok)
+	tr, ok := mt.rt.(*fshttp.Transport)
+	require.True(t, ok, "expected a dedicated tuned transport")
+	assert.Equal(t, 8, tr.MaxIdleConns)
+	assert.Equal(t, 8, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, 30*time.Second, tr.IdleConnTimeout)
+}
+
+// TestMove checks a rename streams the object within the zone,
+// preserves its checksum, keeps both directory caches coherent, and
+// refuses sources from other remotes.
+func TestMove(t *testing.T) {
+	z := newTestZone()
+	z.put("dir1/a.txt", "move me")
+	z.put("dir2/keep.txt", "stays")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	src, err := f.NewObject(ctx, "dir1/a.txt")
+	require.NoError(t, err)
+	srcSum, err := src.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	require.NotEmpty(t, srcSum)
+
+	// Prime both directory caches so the move has to keep them coherent
+	_, err = f.List(ctx, "dir1")
+	require.NoError(t, err)
+	_, err = f.List(ctx, "dir2")
+	require.NoError(t, err)
+
+	moved, err := f.Move(ctx, src, "dir2/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "dir2/b.txt", moved.Remote())
+	movedSum, err := moved.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, srcSum, movedSum, "move should preserve the checksum")
+
+	_, srcLeft := z.objects["dir1/a.txt"]
+	assert.False(t, srcLeft, "source should be deleted")
+	assert.Equal(t, "move me", string(z.objects["dir2/b.txt"].data))
+
+	// Both directory caches reflect the move
+	entries, err := f.List(ctx, "dir1")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	entries, err = f.List(ctx, "dir2")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	assert.ElementsMatch(t, []string{"dir2/b.txt", "dir2/keep.txt"}, names)
+
+	// A source from another remote can't be moved server-side
+	foreign := object.NewMemoryObject("c.txt", time.Now(), []byte("foreign"))
+	_, err = f.Move(ctx, foreign, "c.txt")
+	assert.Equal(t, fs.ErrorCantMove, err)
+}
+
+// TestMoveOverwritePolicy checks Move under move_overwrite_policy
+// "if-newer": differing content is rewritten, identical content is
+// skipped with just the source deleted.
+func TestMoveOverwritePolicy(t *testing.T) {
+	z := newTestZone()
+	z.put("src1.txt", "new content")
+	z.put("dst1.txt", "old content")
+	z.put("src2.txt", "same content")
+	z.put("dst2.txt", "same content")
+	f := newTestFs(t, z, configmap.Simple{"move_overwrite_policy": "if-newer"})
+	ctx := context.Background()
+
+	// Differing content overwrites the destination
+	src, err := f.NewObject(ctx, "src1.txt")
+	require.NoError(t, err)
+	moved, err := f.Move(ctx, src, "dst1.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "dst1.txt", moved.Remote())
+	rc, err := moved.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "new content", string(data))
+	_, err = f.NewObject(ctx, "src1.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// Identical content isn't rewritten - the source is just deleted
+	src, err = f.NewObject(ctx, "src2.txt")
+	require.NoError(t, err)
+	moved, err = f.Move(ctx, src, "dst2.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "dst2.txt", moved.Remote())
+	assert.Equal(t, 0, z.countRequests("PUT /testzone/dst2.txt"))
+	_, err = f.NewObject(ctx, "src2.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
+
+// TestPublicLink checks link generation through a pull zone, both
+// unsigned and signed with token authentication.
+func TestPublicLink(t *testing.T) {
+	newZone := func() *testZone {
+		z := newTestZone()
+		z.put("dir/file.txt", "hello")
+		return z
+	}
+	ctx := context.Background()
+
+	// Without a pull zone hostname links can't be generated
+	f := newTestFs(t, newZone(), nil)
+	_, err := f.PublicLink(ctx, "dir/file.txt", 0, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pull_zone_hostname")
+
+	// Plain unsigned link
+	f = newTestFs(t, newZone(), configmap.Simple{"pull_zone_hostname": "myzone.b-cdn.net"})
+	link, err := f.PublicLink(ctx, "dir/file.txt", 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, "https://myzone.b-cdn.net/dir/file.txt", link)
+
+	// A missing object is reported rather than linked
+	_, err = f.PublicLink(ctx, "missing.txt", 0, false)
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// With a token key the link is signed and carries the expiry
+	f = newTestFs(t, newZone(), configmap.Simple{
+		"pull_zone_hostname": "myzone.b-cdn.net",
+		"token_auth_key":     "sekrit",
+	})
+	link, err = f.PublicLink(ctx, "dir/file.txt", fs.Duration(time.Hour), false)
+	require.NoError(t, err)
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	assert.Equal(t, "/dir/file.txt", u.Path)
+	expires, err := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), expires, 10)
+	sum := sha256.Sum256([]byte("sekrit/dir/file.txt" + strconv.FormatInt(expires, 10)))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), u.Query().Get("token"))
+}
+
+// TestLargeDirThreshold checks the warning fires once when a listing
+// reaches the threshold and not for small directories.
+func TestLargeDirThreshold(t *testing.T) {
+	z := newTestZone()
+	for i := 0; i < 5; i++ {
+		z.put(fmt.Sprintf("file%d.txt", i), "x")
+	}
+	z.put("small/only.txt", "x")
+	f := newTestFs(t, z, configmap.Simple{"large_dir_threshold": "3"})
+	ctx := context.Background()
+
+	var (
+		mu       sync.Mutex
+		warnings int
+	)
+	oldLogPrint := fs.LogPrint
+	fs.LogPrint = func(level fs.LogLevel, text string) {
+		if strings.Contains(text, "large_dir_threshold") {
+			mu.Lock()
+			warnings++
+			mu.Unlock()
+		}
+	}
+	defer func() { fs.LogPrint = oldLogPrint }()
+
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, warnings)
+
+	// Refetching the same directory doesn't warn again
+	f.cache.Clear("")
+	_, err = f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, warnings)
+
+	// A directory under the threshold doesn't warn
+	_, err = f.List(ctx, "small")
+	require.NoError(t, err)
+	assert.Equal(t, 1, warnings)
+}
+
+// TestExposeRawMetadata checks the raw listing fields appear in
+// object metadata under bunny- keys when expose_raw_metadata is set
+// and are omitted by default.
+func TestExposeRawMetadata(t *testing.T) {
+	newZone := func() *testZone {
+		z := newTestZone()
+		z.put("dir/file.txt", "x")
+		z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+			if r.Method != "GET" || !strings.HasSuffix(r.URL.Path, "/dir/") {
+				return false
+			}
+			items := []api.DirItem{{
+				Guid:            "raw-guid",
+				StorageZoneName: testZoneName,
+				Path:            "/" + testZoneName + "/dir/",
+				ObjectName:      "file.txt",
+				Length:          1,
+				LastChanged:     "2024-01-02T03:04:05.678",
+				ServerId:        42,
+				ArrayNumber:     7,
+				UserId:          "raw-user",
+				DateCreated:     "2024-01-01T00:00:00.000",
+				StorageZoneId:   1000,
+			}}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(items)
+			return true
+		}
+		return z
+	}
+	ctx := context.Background()
+
+	f := newTestFs(t, newZone(), configmap.Simple{"expose_raw_metadata": "true"})
+	o, err := f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	meta, err := o.(*Object).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "raw-guid", meta["bunny-guid"])
+	assert.Equal(t, "42", meta["bunny-server-id"])
+	assert.Equal(t, "7", meta["bunny-array-number"])
+	assert.Equal(t, "raw-user", meta["bunny-user-id"])
+	assert.Equal(t, "1000", meta["bunny-storage-zone-id"])
+	assert.Equal(t, "2024-01-01T00:00:00.000", meta["bunny-date-created"])
+	assert.Equal(t, testZoneName, meta["bunny-storage-zone-name"])
+
+	// Off by default
+	f = newTestFs(t, newZone(), nil)
+	o, err = f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	meta, err = o.(*Object).Metadata(ctx)
+	require.NoError(t, err)
+	for key := range meta {
+		assert.False(t, strings.HasPrefix(key, "bunny-"), "unexpected raw metadata key %q", key)
+	}
+}
+
+// TestRefreshCacheEntryPath checks a cache entry synthesized after an
+// upload carries the same unescaped Path the listing API reports, even
+// for directory names that URL-escape.
+func TestRefreshCacheEntryPath(t *testing.T) {
+	z := newTestZone()
+	z.put("my dir #100%/old.txt", "x")
+	f := newTestFs(t, z, configmap.Simple{"expose_raw_metadata": "true"})
+	ctx := context.Background()
+
+	// Prime the directory cache so the upload patches it in place
+	_, err := f.List(ctx, "my dir #100%")
+	require.NoError(t, err)
+	putTestFile(t, f, "my dir #100%/new.txt", "y")
+
+	o, err := f.NewObject(ctx, "my dir #100%/new.txt")
+	require.NoError(t, err)
+	meta, err := o.(*Object).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "/"+testZoneName+"/my dir #100%/", meta["bunny-path"])
+}
+
+// TestMetadataHeaders checks that only whitelisted response headers
+// appear in the metadata map.
+func TestMetadataHeaders(t *testing.T) {
+	z := newTestZone()
+	z.put("file.txt", "hello")
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "HEAD" && strings.HasSuffix(r.URL.Path, "/file.txt") {
+			w.Header().Set("ETag", `"abc123"`)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("X-Internal-Debug", "noise")
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, configmap.Simple{"metadata_headers": "ETag,Cache-Control"})
+	// A bare object so Metadata falls back to a HEAD request
+	o := &Object{fs: f, remote: "file.txt", size: 5}
+	meta, err := o.Metadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, `"abc123"`, meta["etag"])
+	assert.Equal(t, "max-age=60", meta["cache-control"])
+	_, found := meta["x-internal-debug"]
+	assert.False(t, found, "header off the whitelist shouldn't be surfaced")
+}
+
+// TestFutureModtimePolicy checks each future_modtime_policy outcome
+// for an object dated implausibly far in the future.
+func TestFutureModtimePolicy(t *testing.T) {
+	future := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	newZone := func() *testZone {
+		z := newTestZone()
+		z.put("a.txt", "from the future").lastChanged = future
+		return z
+	}
+	ctx := context.Background()
+
+	// keep (the default) uses the stored timestamp as is
+	f := newTestFs(t, newZone(), nil)
+	o, err := f.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.WithinDuration(t, future, o.ModTime(ctx), time.Second)
+
+	// clamp replaces it with the current time
+	f = newTestFs(t, newZone(), configmap.Simple{"future_modtime_policy": "clamp"})
+	o, err = f.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), o.ModTime(ctx), time.Minute)
+
+	// warn keeps it but logs
+	var (
+		mu       sync.Mutex
+		warnings int
+	)
+	oldLogPrint := fs.LogPrint
+	fs.LogPrint = func(level fs.LogLevel, text string) {
+		if strings.Contains(text, "implausibly far in the future") {
+			mu.Lock()
+			warnings++
+			mu.Unlock()
+		}
+	}
+	defer func() { fs.LogPrint = oldLogPrint }()
+	f = newTestFs(t, newZone(), configmap.Simple{"future_modtime_policy": "warn"})
+	o, err = f.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.WithinDuration(t, future, o.ModTime(ctx), time.Second)
+	mu.Lock()
+	assert.Equal(t, 1, warnings)
+	mu.Unlock()
+}
+
+// TestProactiveThrottle checks requests slow down when the zone
+// reports a low rate-limit budget and speed up when it recovers,
+// without a 429 ever occurring.
+func TestProactiveThrottle(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "aaa")
+	z.put("sub/b.txt", "bbb")
+	f := newTestFs(t, z, configmap.Simple{"proactive_throttle": "true"})
+	ctx := context.Background()
+
+	mt, ok := f.httpClient.Transport.(*metricsTransport)
+	require.True(t, ok)
+	tt, ok := mt.rt.(*throttleTransport)
+	require.True(t, ok)
+	delay := func() time.Duration {
+		tt.mu.Lock()
+		defer tt.mu.Unlock()
+		return tt.delay
+	}
+
+	var (
+		mu        sync.Mutex
+		remaining string
+	)
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		w.Header().Set("X-RateLimit-Remaining", remaining)
+		mu.Unlock()
+		return false
+	}
+
+	// A low budget starts spacing requests out
+	mu.Lock()
+	remaining = "9"
+	mu.Unlock()
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 200*time.Millisecond, delay())
+
+	// The next request is delayed, and a recovered budget resets the
+	// delay again
+	mu.Lock()
+	remaining = "50"
+	mu.Unlock()
+	start := time.Now()
+	_, err = f.List(ctx, "sub")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "the low budget should have delayed the request")
+	assert.Equal(t, time.Duration(0), delay())
+}
+
+// TestAutoRegion checks auto_region picks the fastest endpoint
+// serving the zone and caches the choice for the process.
+func TestAutoRegion(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	var slowProbes int32
+	stub := func(delay time.Duration, status int, probes *int32) *httptest.Server {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if probes != nil {
+				atomic.AddInt32(probes, 1)
+			}
+			time.Sleep(delay)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte("[]"))
+		}))
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	fast := stub(0, http.StatusOK, nil)
+	slow := stub(50*time.Millisecond, http.StatusOK, &slowProbes)
+	notServing := stub(0, http.StatusNotFound, nil)
+
+	oldEndpoints := autoRegionEndpoints
+	autoRegionEndpoints = []string{slow.URL, fast.URL, notServing.URL}
+	defer func() {
+		autoRegionEndpoints = oldEndpoints
+		autoRegionMu.Lock()
+		delete(autoRegionCache, testZoneName)
+		autoRegionMu.Unlock()
+	}()
+
+	f.selectRegion(ctx)
+	assert.Equal(t, fast.URL, f.endpoint)
+
+	// A second remote for the same zone reuses the cached choice
+	// without re-probing
+	f2 := newTestFs(t, z, nil)
+	probesBefore := atomic.LoadInt32(&slowProbes)
+	f2.selectRegion(ctx)
+	assert.Equal(t, fast.URL, f2.endpoint)
+	assert.Equal(t, probesBefore, atomic.LoadInt32(&slowProbes))
+}
+
+// TestResolveEndpoint checks storage_endpoint values map to the right
+// endpoint URLs.
+func TestResolveEndpoint(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{value: "", want: "https://storage.bunnycdn.com"},
+		{value: "de", want: "https://storage.bunnycdn.com"},
+		{value: "ny", want: "https://ny.storage.bunnycdn.com"},
+		{value: "NY", want: "https://ny.storage.bunnycdn.com"},
+		{value: "syd", want: "https://syd.storage.bunnycdn.com"},
+		{value: "https://example.com/", want: "https://example.com"},
+		{value: "http://localhost:8080", want: "http://localhost:8080"},
+		{value: "not a region", err: true},
+		{value: "ny2", err: true},
+	} {
+		got, err := resolveEndpoint(test.value)
+		if test.err {
+			assert.Error(t, err, test.value)
+			continue
+		}
+		require.NoError(t, err, test.value)
+		assert.Equal(t, test.want, got, test.value)
+	}
+}
+
+// TestZoneNameValidation checks that implausible storage zone names
+// are rejected at construction rather than 404ing on every request.
+func TestZoneNameValidation(t *testing.T) {
+	for _, test := range []struct {
+		zone string
+		ok   bool
+	}{
+		{"testzone", true},
+		{"my-zone-01", true},
+		{"MyZone", true},
+		{"", false},
+		{"-zone", false},
+		{"zone-", false},
+		{"my zone", false},
+		{"zone/../other", false},
+		{strings.Repeat("z", 65), false},
+	} {
+		err := validateZoneName(test.zone)
+		if test.ok {
+			assert.NoError(t, err, "zone %q", test.zone)
+		} else {
+			assert.Error(t, err, "zone %q", test.zone)
+		}
+	}
+
+	_, err := NewFs(context.Background(), "bunny", "", configmap.Simple{
+		"storage_zone": "bad zone",
+		"access_key":   testAccessKey,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid storage_zone")
+}
+
+// TestRetryOnCorruption checks that Open refetches a download whose
+// content doesn't match the stored checksum.
+func TestRetryOnCorruption(t *testing.T) {
+	z := newTestZone()
+	z.put("file.txt", "clean content")
+	// The first download returns corrupted content, subsequent ones
+	// are clean
+	corrupt := true
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/file.txt") && corrupt {
+			corrupt = false
+			_, _ = w.Write([]byte("CORRUPT!!"))
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, configmap.Simple{"retry_on_corruption": "2"})
+	ctx := context.Background()
+	obj, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "clean content", string(data))
+	assert.Equal(t, 2, z.countRequests("GET /testzone/file.txt"))
+}
+
+// TestRequestTimeout checks the flat timeout option cuts off a
+// stalled request with a deadline error.
+func TestRequestTimeout(t *testing.T) {
+	z := newTestZone()
+	z.put("slow.txt", "sloooow")
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/slow.txt") {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return false
+	}
+	f := newTestFs(t, z, configmap.Simple{"timeout": "100ms"})
+	ctx := context.Background()
+
+	o, err := f.NewObject(ctx, "slow.txt")
+	require.NoError(t, err)
+	_, err = o.Open(ctx)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected a deadline error, got %v", err)
+}
+
+// TestTimeoutEscalation checks that transfers get a deadline scaled by
+// the payload size while metadata calls get the short fixed one.
+func TestTimeoutEscalation(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{
+		"metadata_timeout": "30s",
+		"transfer_timeout": "5m",
+	})
+	ctx := context.Background()
+
+	var (
+		mu        sync.Mutex
+		deadlines = map[string]time.Time{}
+	)
+	base := f.httpClient.Transport
+	f.httpClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if d, ok := req.Context().Deadline(); ok {
+			mu.Lock()
+			deadlines[req.Method] = d
+			mu.Unlock()
+		}
+		return base.RoundTrip(req)
+	})
+
+	data := []byte("payload")
+	src := object.NewStaticObjectInfo("big.bin", time.Now(), int64(len(data)), true, nil, nil)
+	_, err := f.Put(ctx, bytes.NewReader(data), src)
+	require.NoError(t, err)
+	_, err = f.List(ctx, "")
+	require.NoError(t, err)
+
+	require.Contains(t, deadlines, "PUT")
+	require.Contains(t, deadlines, "GET")
+	assert.True(t, deadlines["PUT"].After(deadlines["GET"]), "upload deadline should outlast the list deadline")
+
+	// The transfer deadline grows with the payload size
+	small, cancelSmall := f.transferCtx(ctx, 1)
+	defer cancelSmall()
+	large, cancelLarge := f.transferCtx(ctx, 512*1024*1024)
+	defer cancelLarge()
+	smallDeadline, ok := small.Deadline()
+	require.True(t, ok)
+	largeDeadline, ok := large.Deadline()
+	require.True(t, ok)
+	assert.GreaterOrEqual(t, largeDeadline.Sub(smallDeadline), 8*time.Minute)
+}
+
+// TestScrubCommand checks the scrub command reports corrupted objects
+// and resumes from its state file.
+func TestScrubCommand(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "aaa")
+	z.put("b.txt", "bbb")
+	z.put("sub/c.txt", "ccc")
+	// Downloads of b.txt return content which doesn't match the
+	// checksum in the listing
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/b.txt") {
+			_, _ = w.Write([]byte("CORRUPT"))
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+	stateFile := filepath.Join(t.TempDir(), "scrub.state")
+	scrubOpts := map[string]string{"concurrency": "2", "state-file": stateFile}
+
+	out, err := f.Command(ctx, "scrub", nil, scrubOpts)
+	require.NoError(t, err)
+	result, ok := out.(scrubResult)
+	require.True(t, ok)
+	assert.Equal(t, 3, result.Scanned)
+	assert.Equal(t, []string{"b.txt"}, result.Corrupted)
+
+	// A re-run skips the verified objects and rechecks the corrupted one
+	out, err = f.Command(ctx, "scrub", nil, scrubOpts)
+	require.NoError(t, err)
+	result = out.(scrubResult)
+	assert.Equal(t, 2, result.Skipped)
+	assert.Equal(t, 1, result.Scanned)
+	assert.Equal(t, []string{"b.txt"}, result.Corrupted)
+
+	// Once the corruption is gone the scrub is clean and the state
+	// file is removed ready for the next audit
+	z.mu.Lock()
+	z.intercept = nil
+	z.mu.Unlock()
+	out, err = f.Command(ctx, "scrub", nil, scrubOpts)
+	require.NoError(t, err)
+	result = out.(scrubResult)
+	assert.Equal(t, 1, result.Scanned)
+	assert.Equal(t, 2, result.Skipped)
+	assert.Empty(t, result.Corrupted)
+	_, err = os.Stat(stateFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestScrubConcurrency checks the scrub runs scrub_concurrency
+// downloads in parallel but no more, and still reports every
+// corruption.
+func TestScrubConcurrency(t *testing.T) {
+	z := newTestZone()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt", "f.txt"} {
+		z.put(name, "contents of "+name)
+	}
+	var inflight, maxInflight int32
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && !strings.HasSuffix(r.URL.Path, "/") {
+			n := atomic.AddInt32(&inflight, 1)
+			for {
+				seen := atomic.LoadInt32(&maxInflight)
+				if n <= seen || atomic.CompareAndSwapInt32(&maxInflight, seen, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&inflight, -1)
+			if strings.HasSuffix(r.URL.Path, "/b.txt") || strings.HasSuffix(r.URL.Path, "/d.txt") {
+				_, _ = w.Write([]byte("CORRUPT"))
+				return true
+			}
+		}
+		return false
+	}
+	f := newTestFs(t, z, configmap.Simple{"scrub_concurrency": "2"})
+	ctx := context.Background()
+
+	out, err := f.Command(ctx, "scrub", nil, nil)
+	require.NoError(t, err)
+	result, ok := out.(scrubResult)
+	require.True(t, ok)
+	assert.Equal(t, 6, result.Scanned)
+	assert.Equal(t, []string{"b.txt", "d.txt"}, result.Corrupted)
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInflight), int32(2), "scrub should honor scrub_concurrency")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInflight), "scrub should verify in parallel")
+}
+
+// TestTrailingDotNames checks that trailing-dot directory names
+// round-trip by default and are rejected under strict_names.
+func TestTrailingDotNames(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	// Default: uploads into a trailing-dot directory round-trip
+	putTestFile(t, f, "dir./file.txt", "dotty")
+	obj, err := f.NewObject(ctx, "dir./file.txt")
+	require.NoError(t, err)
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "dotty", data)
+
+	// strict_names: rejected with a clear error
+	fStrict := newTestFs(t, newTestZone(), configmap.Simple{"strict_names": "true"})
+	info, in := testInfo("dir./file.txt", "dotty")
+	_, err = fStrict.Put(ctx, in, info)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "trailing dot")
+	err = fStrict.Mkdir(ctx, "bad.")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "trailing dot")
+}
+
+// TestRangeProbe checks the single-byte ranged GET existence check
+// selected by probe_mode=range.
+func TestRangeProbe(t *testing.T) {
+	z := newTestZone()
+	z.put("probe.txt", "probe me please")
+	z.put("realdir/x.txt", "inside")
+	var mu sync.Mutex
+	var ranges []string
+	base := z.intercept
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && !strings.HasSuffix(r.URL.Path, "/") {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		if base != nil {
+			return base(w, r)
+		}
+		return false
+	}
+	f := newTestFs(t, z, configmap.Simple{"probe_mode": "range"})
+	ctx := context.Background()
+
+	obj, err := f.NewObject(ctx, "probe.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), obj.Size())
+	assert.False(t, obj.ModTime(ctx).IsZero())
+
+	// A hit is served by the probe alone - no directory listings
+	mu.Lock()
+	require.Equal(t, []string{"bytes=0-0"}, ranges)
+	mu.Unlock()
+	z.mu.Lock()
+	for _, r := range z.requests {
+		assert.False(t, strings.HasSuffix(r, "/"), "unexpected listing request %q", r)
+	}
+	z.mu.Unlock()
+
+	// A 404 is ambiguous - the name may be a directory or a packed
+	// file - so a miss falls back to the listing lookup
+	_, err = f.NewObject(ctx, "missing.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	_, err = f.NewObject(ctx, "realdir")
+	assert.Equal(t, fs.ErrorIsDir, err)
+
+	// An implausible checksum header is dropped the way listings drop
+	// it, and a missing timestamp goes through missing_modtime_policy
+	f.cache.ClearAll()
+	z.mu.Lock()
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/probe.txt") {
+			w.Header().Set("Checksum", "not-a-sha256")
+			w.Header().Set("Content-Range", "bytes 0-0/15")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write([]byte("p"))
+			return true
+		}
+		return false
+	}
+	z.mu.Unlock()
+	obj, err = f.NewObject(ctx, "probe.txt")
+	require.NoError(t, err)
+	sum, err := obj.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, "", sum, "implausible probe checksum should be dropped")
+
+	fErr := newTestFs(t, z, configmap.Simple{"probe_mode": "range", "missing_modtime_policy": "error"})
+	_, err = fErr.NewObject(ctx, "probe.txt")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unparseable timestamp")
+
+	// The probe marks the object so Metadata backfills the Guid and
+	// replicated zones from the parent listing
+	z.mu.Lock()
+	z.intercept = base
+	z.replicatedZones = "DE,NY"
+	z.mu.Unlock()
+	f.cache.ClearAll()
+	obj, err = f.NewObject(ctx, "probe.txt")
+	require.NoError(t, err)
+	meta, err := obj.(*Object).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "DE,NY", meta["replicated-zones"])
+	assert.NotEmpty(t, obj.(*Object).id)
+
+	// Packed files are still findable - their probe 404s and the
+	// listing lookup takes over
+	fPack := newTestFs(t, z, configmap.Simple{"probe_mode": "range", "pack_small_files": "1Ki"})
+	putTestFile(t, fPack, "pack/tiny.txt", "tiny")
+	fPack.cache.ClearAll()
+	pobj, err := fPack.NewObject(ctx, "pack/tiny.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), pobj.Size())
+
+	// Collision policies are honored too - the probe is skipped so
+	// the listing can see both names
+	z.put("foo", "file contents")
+	z.put("foo/inner.txt", "inner")
+	fDir := newTestFs(t, z, configmap.Simple{"probe_mode": "range", "name_collision_policy": "prefer-dir"})
+	_, err = fDir.NewObject(ctx, "foo")
+	assert.Equal(t, fs.ErrorIsDir, err)
+}
+
+// TestMissingModtimePolicy checks each policy's behavior for an
+// object with an unparseable timestamp.
+func TestMissingModtimePolicy(t *testing.T) {
+	makeZone := func() *testZone {
+		z := newTestZone()
+		z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+			if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/") {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode([]map[string]any{{
+					"Guid":        "guid-bad",
+					"ObjectName":  "bad-time.txt",
+					"Length":      3,
+					"LastChanged": "not-a-timestamp",
+					"IsDirectory": false,
+				}})
+				return true
+			}
+			return false
+		}
+		return z
+	}
+	ctx := context.Background()
+
+	// zero (the default): stable zero time
+	f := newTestFs(t, makeZone(), nil)
+	obj, err := f.NewObject(ctx, "bad-time.txt")
+	require.NoError(t, err)
+	assert.True(t, obj.ModTime(ctx).IsZero())
+
+	// now: approximately the current time
+	f = newTestFs(t, makeZone(), configmap.Simple{"missing_modtime_policy": "now"})
+	obj, err = f.NewObject(ctx, "bad-time.txt")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), obj.ModTime(ctx), time.Minute)
+
+	// error: the lookup fails with a descriptive error
+	f = newTestFs(t, makeZone(), configmap.Simple{"missing_modtime_policy": "error"})
+	_, err = f.NewObject(ctx, "bad-time.txt")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unparseable timestamp")
+}
+
+// TestUploadChecksumVerification checks that the checksum bunny
+// returns after an upload is compared against the source hash.
+func TestUploadChecksumVerification(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	// A clean upload stores the server checksum on the object
+	contents := "verified contents"
+	sum := sha256.Sum256([]byte(contents))
+	in := bytes.NewReader([]byte(contents))
+	info := object.NewStaticObjectInfo("ok.txt", time.Now(), int64(len(contents)), true,
+		map[hash.Type]string{hash.SHA256: hex.EncodeToString(sum[:])}, nil)
+	obj, err := f.Put(ctx, in, info)
+	require.NoError(t, err)
+	got, err := obj.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:]), got)
+
+	// A server echoing a different checksum is an integrity error
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "bad.txt") {
+			w.Header().Set("Checksum", strings.Repeat("0", 64))
+			w.WriteHeader(http.StatusCreated)
+			return true
+		}
+		return false
+	}
+	in = bytes.NewReader([]byte(contents))
+	info = object.NewStaticObjectInfo("bad.txt", time.Now(), int64(len(contents)), true,
+		map[hash.Type]string{hash.SHA256: hex.EncodeToString(sum[:])}, nil)
+	_, err = f.Put(ctx, in, info)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "integrity check failed")
+}
+
+// TestUploadServerChecksumCapture checks that when the source can't
+// supply a hash the checksum the server acknowledges is kept on the
+// returned object, so later --checksum syncs need no re-list.
+func TestUploadServerChecksumCapture(t *testing.T) {
+	f := newTestFs(t, newTestZone(), nil)
+	ctx := context.Background()
+
+	// testInfo supplies no hashes, so the only possible source of the
+	// checksum is the upload response
+	obj := putTestFile(t, f, "unhashed.txt", "contents without a source hash")
+	got, err := obj.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("contents without a source hash"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), got)
+}
+
+// TestListCacheKeyNormalization checks that logically identical
+// directory names share a cache entry.
+func TestListCacheKeyNormalization(t *testing.T) {
+	z := newTestZone()
+	z.put("a/file.txt", "x")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	_, err := f.List(ctx, "a")
+	require.NoError(t, err)
+	listings := z.countRequests("GET")
+	_, err = f.List(ctx, "a/")
+	require.NoError(t, err)
+	_, err = f.List(ctx, "./a")
+	require.NoError(t, err)
+	assert.Equal(t, listings, z.countRequests("GET"), "second and third listings should be served from cache")
+}
+
+// TestHTTPCacheProxy checks that downloads are routed through the
+// configured caching proxy while writes go direct.
+func TestHTTPCacheProxy(t *testing.T) {
+	z := newTestZone()
+	z.put("file.txt", "cached contents")
+
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.Method)
+		mu.Unlock()
+		// Forward to the origin
+		req, err := http.NewRequest(r.Method, r.URL.String(), r.Body)
+		require.NoError(t, err)
+		req.Header = r.Header.Clone()
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		for k, vs := range resp.Header {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+
+	f := newTestFs(t, z, configmap.Simple{"http_cache_proxy": proxy.URL})
+	ctx := context.Background()
+
+	obj, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "cached contents", data)
+
+	putTestFile(t, f, "direct.txt", "don't proxy me")
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"GET"}, proxied, "only the download should go via the proxy")
+}
+
+// TestPurgeFast checks that a purge is done with a single recursive
+// DELETE of the directory and that cached listings under the prefix
+// are dropped.
+func TestPurgeFast(t *testing.T) {
+	z := newTestZone()
+	z.put("purgeme/a.txt", "a")
+	z.put("purgeme/sub/b.txt", "b")
+	z.put("keep/c.txt", "c")
+	f := newTestFs(t, z, configmap.Simple{"list_cache_time": "1h"})
+	ctx := context.Background()
+
+	// Warm the listing caches under and next to the purge target
+	_, err := f.List(ctx, "purgeme")
+	require.NoError(t, err)
+	_, err = f.List(ctx, "purgeme/sub")
+	require.NoError(t, err)
+	_, err = f.List(ctx, "keep")
+	require.NoError(t, err)
+
+	deletesBefore := z.countRequests("DELETE ")
+	require.NoError(t, f.Purge(ctx, "purgeme"))
+	assert.Equal(t, 1, z.countRequests("DELETE ")-deletesBefore, "purge should issue a single recursive DELETE")
+	assert.Equal(t, 1, z.countRequests("DELETE /"+testZoneName+"/purgeme/"))
+	z.mu.Lock()
+	left := len(z.objects)
+	z.mu.Unlock()
+	assert.Equal(t, 1, left, "only keep/c.txt should survive")
+
+	// The cached listings under the purged prefix must be gone too
+	_, ok := f.cache.Get("purgeme")
+	assert.False(t, ok)
+	_, ok = f.cache.Get("purgeme/sub")
+	assert.False(t, ok)
+	_, ok = f.cache.Get("keep")
+	assert.True(t, ok, "listings outside the purged prefix should stay cached")
+
+	// Purging a missing directory reports ErrorDirNotFound
+	err = f.Purge(ctx, "missing")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+}
+
+// TestPurgePartialPolicy checks the behavior when some deletes fail
+// during a purge under both policies.
+func TestPurgePartialPolicy(t *testing.T) {
+	newZone := func() *testZone {
+		z := newTestZone()
+		z.put("purgeme/a.txt", "a")
+		z.put("purgeme/b.txt", "b")
+		z.put("purgeme/sub/c.txt", "c")
+		z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+			// Refuse the recursive directory delete so the purge
+			// falls back to the per-object walk under test
+			if r.Method == "DELETE" && strings.HasSuffix(r.URL.Path, "/purgeme/") {
+				writeAPIError(w, http.StatusInternalServerError, "recursive delete not supported")
+				return true
+			}
+			if r.Method == "DELETE" && strings.HasSuffix(r.URL.Path, "/b.txt") {
+				writeAPIError(w, http.StatusInternalServerError, "delete failed")
+				return true
+			}
+			return false
+		}
+		return z
+	}
+	ctx := context.Background()
+
+	// continue: everything else is deleted, the failure is reported
+	// and the directory is left in place
+	z := newZone()
+	f := newTestFs(t, z, configmap.Simple{"purge_partial_policy": "continue"})
+	err := f.Purge(ctx, "purgeme")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "purgeme/b.txt")
+	z.mu.Lock()
+	_, aLeft := z.objects["purgeme/a.txt"]
+	_, bLeft := z.objects["purgeme/b.txt"]
+	_, cLeft := z.objects["purgeme/sub/c.txt"]
+	z.mu.Unlock()
+	assert.False(t, aLeft)
+	assert.True(t, bLeft)
+	assert.False(t, cLeft)
+
+	// abort: stops at the first failure
+	z = newZone()
+	f = newTestFs(t, z, nil)
+	err = f.Purge(ctx, "purgeme")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b.txt")
+	z.mu.Lock()
+	_, bLeft = z.objects["purgeme/b.txt"]
+	z.mu.Unlock()
+	assert.True(t, bLeft)
+
+	// A purge with no failures removes the whole tree
+	z = newZone()
+	z.intercept = nil
+	f = newTestFs(t, z, nil)
+	require.NoError(t, f.Purge(ctx, "purgeme"))
+	z.mu.Lock()
+	left := len(z.objects)
+	z.mu.Unlock()
+	assert.Equal(t, 0, left)
+
+	// Purging a missing directory returns ErrorDirNotFound
+	err = f.Purge(ctx, "missing")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+}
+
+// TestPurgeStateFile checks that an interrupted purge can be resumed
+// via purge_state_file without re-deleting already deleted objects.
+func TestPurgeStateFile(t *testing.T) {
+	z := newTestZone()
+	z.put("purgeme/a.txt", "a")
+	z.put("purgeme/b.txt", "b")
+	// Deletes of a.txt "succeed" but leave the object in the listing,
+	// as happens when the listing lags behind the delete.  Deletes of
+	// b.txt fail outright.
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != "DELETE" {
+			return false
+		}
+		if strings.HasSuffix(r.URL.Path, "/a.txt") {
+			w.WriteHeader(http.StatusOK)
+			return true
+		}
+		if strings.HasSuffix(r.URL.Path, "/b.txt") {
+			writeAPIError(w, http.StatusInternalServerError, "delete failed")
+			return true
+		}
+		return false
+	}
+	stateFile := filepath.Join(t.TempDir(), "purge.state")
+	f := newTestFs(t, z, configmap.Simple{
+		"purge_partial_policy": "continue",
+		"purge_state_file":     stateFile,
+	})
+	ctx := context.Background()
+	err := f.Purge(ctx, "purgeme")
+	require.Error(t, err)
+
+	// The state file records the successful delete but not the failed one
+	data, err := os.ReadFile(stateFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "purgeme/a.txt")
+	assert.NotContains(t, string(data), "purgeme/b.txt")
+
+	// Resume with the failures cleared.  a.txt is still in the listing
+	// but must not be deleted again.
+	z.mu.Lock()
+	z.intercept = nil
+	z.mu.Unlock()
+	aDeletes := z.countRequests("DELETE /" + testZoneName + "/purgeme/a.txt")
+	require.NoError(t, f.Purge(ctx, "purgeme"))
+	assert.Equal(t, aDeletes, z.countRequests("DELETE /"+testZoneName+"/purgeme/a.txt"))
+	z.mu.Lock()
+	left := len(z.objects)
+	z.mu.Unlock()
+	assert.Equal(t, 0, left)
+
+	// A completed purge removes the state file
+	_, err = os.Stat(stateFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestCleanUp checks stray zero-length .partial files are removed
+// along with the directories that emptied, while real content and
+// directories that were already empty survive.
+func TestCleanUp(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "data")
+	z.put("b.bin.partial", "still has data")
+	z.put("tmp/upload.bin.partial", "")
+	z.put("tmp/keep.txt", "k")
+	z.put("junk/leftover.partial", "")
+	z.mu.Lock()
+	z.dirs["hollow"] = true
+	z.mu.Unlock()
+	f := newTestFs(t, z, nil)
+
+	require.NoError(t, f.CleanUp(context.Background()))
+
+	z.mu.Lock()
+	_, aLeft := z.objects["a.txt"]
+	_, bLeft := z.objects["b.bin.partial"]
+	_, uploadLeft := z.objects["tmp/upload.bin.partial"]
+	_, keepLeft := z.objects["tmp/keep.txt"]
+	_, junkLeft := z.objects["junk/leftover.partial"]
+	_, hollowLeft := z.dirs["hollow"]
+	junkDirLeft := z.dirExists("junk")
+	z.mu.Unlock()
+	assert.True(t, aLeft, "real files must survive")
+	assert.True(t, bLeft, "a .partial with content must survive")
+	assert.False(t, uploadLeft, "zero-length .partial should be removed")
+	assert.True(t, keepLeft)
+	assert.False(t, junkLeft)
+	assert.True(t, hollowLeft, "directory that was already empty must survive")
+	assert.False(t, junkDirLeft, "directory emptied by cleanup should be removed")
+}
+
+// TestListRMetadataFromListing checks that a metadata-enabled
+// recursive listing takes its system metadata from the directory
+// listings, spending at most one HEAD per object on the user metadata
+// and never probing for sidecars the listings didn't show.
+func TestListRMetadataFromListing(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "one")
+	z.put("dir/b.txt", "two")
+	z.put("dir/sub/c.txt", "three")
+	f := newTestFs(t, z, nil)
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Metadata = true
+
+	// One object with header-stored user metadata and one whose
+	// metadata lives in a sidecar - both must survive ListR
+	userMeta := fs.Metadata{"user-foo": "bar"}
+	info := object.NewStaticObjectInfo("attrs.txt", time.Now(), 4, true, nil, nil).WithMetadata(userMeta)
+	_, err := f.Put(ctx, bytes.NewReader([]byte("four")), info)
+	require.NoError(t, err)
+	bigMeta := fs.Metadata{"user-big": strings.Repeat("x", 2*xattrHeaderLimit)}
+	info = object.NewStaticObjectInfo("bigattrs.txt", time.Now(), 4, true, nil, nil).WithMetadata(bigMeta)
+	_, err = f.Put(ctx, bytes.NewReader([]byte("five")), info)
+	require.NoError(t, err)
+	f.cache.ClearAll()
+	z.mu.Lock()
+	z.requests = nil
+	z.mu.Unlock()
+
+	var objs []*Object
+	err = f.ListR(ctx, "", func(entries fs.DirEntries) error {
+		for _, e := range entries {
+			if o, ok := e.(*Object); ok {
+				objs = append(objs, o)
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 5, len(objs))
+
+	for _, o := range objs {
+		meta, err := o.Metadata(ctx)
+		require.NoError(t, err)
+		assert.NotEmpty(t, meta["mtime"])
+		assert.NotEmpty(t, meta["content-type"])
+		switch o.Remote() {
+		case "attrs.txt":
+			assert.Equal(t, "bar", meta["user-foo"])
+		case "bigattrs.txt":
+			assert.Equal(t, bigMeta["user-big"], meta["user-big"])
+		}
+		sum, err := o.Hash(ctx, hash.SHA256)
+		require.NoError(t, err)
+		assert.NotEmpty(t, sum)
+		assert.False(t, o.ModTime(ctx).IsZero())
+	}
+
+	// Only directory listings, one HEAD per object for the user
+	// metadata, and the single sidecar read should have been made -
+	// in particular no sidecar probes for objects without one.
+	z.mu.Lock()
+	heads := 0
+	for _, r := range z.requests {
+		switch {
+		case strings.HasPrefix(r, "HEAD "):
+			heads++
+		case r == "GET /"+testZoneName+"/bigattrs.txt"+metadataSidecarSuffix:
+		default:
+			assert.True(t, strings.HasSuffix(r, "/"), "unexpected per-object request %q", r)
+		}
+	}
+	z.mu.Unlock()
+	assert.Equal(t, 5, heads)
+}
+
+// TestShouldRetryStatuses checks which HTTP statuses are retried and
+// that a Retry-After header, in both its forms, sets the pacer delay.
+func TestShouldRetryStatuses(t *testing.T) {
+	f := newTestFs(t, newTestZone(), nil)
+	ctx := context.Background()
+	respWith := func(status int, retryAfterValue string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if retryAfterValue != "" {
+			resp.Header.Set("Retry-After", retryAfterValue)
+		}
+		return resp
+	}
+	boom := errors.New("boom")
+
+	for _, status := range []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	} {
+		retry, _ := f.shouldRetry(ctx, respWith(status, ""), boom)
+		assert.True(t, retry, "status %d should be retried", status)
+	}
+	retry, _ := f.shouldRetry(ctx, respWith(http.StatusForbidden, ""), boom)
+	assert.False(t, retry, "403 should not be retried")
+
+	// Retry-After in seconds form
+	retry, err := f.shouldRetry(ctx, respWith(http.StatusServiceUnavailable, "7"), boom)
+	assert.True(t, retry)
+	delay, ok := pacer.IsRetryAfter(err)
+	require.True(t, ok)
+	assert.Equal(t, 7*time.Second, delay)
+
+	// Retry-After in HTTP-date form
+	when := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	retry, err = f.shouldRetry(ctx, respWith(http.StatusTooManyRequests, when), boom)
+	assert.True(t, retry)
+	delay, ok = pacer.IsRetryAfter(err)
+	require.True(t, ok)
+	assert.InDelta(t, 30*time.Second, delay, float64(5*time.Second))
+
+	// A rate limit without the header keeps the fixed default delay
+	retry, err = f.shouldRetry(ctx, respWith(http.StatusTooManyRequests, ""), boom)
+	assert.True(t, retry)
+	delay, ok = pacer.IsRetryAfter(err)
+	require.True(t, ok)
+	assert.Equal(t, retryAfter, delay)
+
+	// A 5xx without the header leaves the delay to the pacer backoff
+	retry, err = f.shouldRetry(ctx, respWith(http.StatusInternalServerError, ""), boom)
+	assert.True(t, retry)
+	_, ok = pacer.IsRetryAfter(err)
+	assert.False(t, ok)
+}
+
+// TestRetryableCodes checks that a body carrying a configured
+// retryable error code is retried even under a non-standard status.
+func TestRetryableCodes(t *testing.T) {
+	z := newTestZone()
+	z.put("file.txt", "hello")
+	failures := 0
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if failures < 2 && r.Method == "GET" {
+			failures++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTeapot)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"HttpCode":  http.StatusTeapot,
+				"Message":   "transient zone condition",
+				"ErrorCode": 1042,
+			})
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, configmap.Simple{"retryable_codes": "1042"})
+
+	entries, err := f.List(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, 2, failures, "expected the listing to be retried past the failures")
+
+	// Without the code configured the same failure must be permanent
+	z.mu.Lock()
+	z.requests = nil
+	z.mu.Unlock()
+	failures = 0
+	f2 := newTestFs(t, z, nil)
+	f2.cache.ClearAll()
+	_, err = f2.List(context.Background(), "")
+	require.Error(t, err)
+	assert.Equal(t, 1, failures)
+}
+
+// TestWriteRetry checks that uploads and deletes go through the pacer
+// so a transient 503 is retried rather than surfaced to the caller.
+func TestWriteRetry(t *testing.T) {
+	z := newTestZone()
+	putFailures := 0
+	deleteFailures := 0
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if putFailures < 2 && r.Method == "PUT" {
+			putFailures++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		if deleteFailures < 2 && r.Method == "DELETE" {
+			deleteFailures++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	// The upload body is a seekable reader so the pacer can replay it
+	info, in := testInfo("retried.txt", "retried contents")
+	obj, err := f.Put(ctx, in, info)
+	require.NoError(t, err)
+	assert.Equal(t, 2, putFailures, "expected the upload to be retried past the failures")
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "retried contents", string(data))
+
+	require.NoError(t, obj.Remove(ctx))
+	assert.Equal(t, 2, deleteFailures, "expected the delete to be retried past the failures")
+	_, err = f.NewObject(ctx, "retried.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// purgeFast's recursive directory DELETE is paced too
+	putTestFile(t, f, "dir/a.txt", "contents")
+	deleteFailures = 0
+	require.NoError(t, f.Purge(ctx, "dir"))
+	assert.Equal(t, 2, deleteFailures, "expected the purge to be retried past the failures")
+}
+
+// TestXattrRoundTrip checks that user metadata (e.g. xattrs) survives
+// a Put and comes back via Metadata, using the header for small sets
+// and the sidecar object for large ones.
+func TestXattrRoundTrip(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Metadata = true
+
+	// Small metadata set - should be stored in a header
+	meta := fs.Metadata{"user-foo": "bar", "security-selinux": "system_u:object_r:user_home_t:s0"}
+	in := bytes.NewReader([]byte("contents"))
+	info := object.NewStaticObjectInfo("attrs.txt", time.Now(), 8, true, nil, nil).WithMetadata(meta)
+	obj, err := f.Put(ctx, in, info)
+	require.NoError(t, err)
+
+	got, err := obj.(*Object).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", got["user-foo"])
+	assert.Equal(t, meta["security-selinux"], got["security-selinux"])
+	z.mu.Lock()
+	_, hasSidecar := z.objects["attrs.txt"+metadataSidecarSuffix]
+	z.mu.Unlock()
+	assert.False(t, hasSidecar, "small metadata shouldn't use a sidecar")
+
+	// Large metadata set - should fall back to a sidecar
+	bigMeta := fs.Metadata{"user-big": strings.Repeat("x", 2*xattrHeaderLimit)}
+	in = bytes.NewReader([]byte("contents"))
+	info = object.NewStaticObjectInfo("bigattrs.txt", time.Now(), 8, true, nil, nil).WithMetadata(bigMeta)
+	obj, err = f.Put(ctx, in, info)
+	require.NoError(t, err)
+
+	got, err = obj.(*Object).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, bigMeta["user-big"], got["user-big"])
+	z.mu.Lock()
+	_, hasSidecar = z.objects["bigattrs.txt"+metadataSidecarSuffix]
+	z.mu.Unlock()
+	assert.True(t, hasSidecar, "large metadata should use a sidecar")
+
+	// Sidecars must not show up in listings
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.NotContains(t, e.Remote(), metadataSidecarSuffix)
+	}
+}
+
+// TestReadOnlyObjectError checks that overwriting a read-only object
+// returns a descriptive error when clearing isn't permitted.
+func TestReadOnlyObjectError(t *testing.T) {
+	z := newTestZone()
+	z.put("locked.txt", "old")
+	z.readOnly["locked.txt"] = true
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	obj, err := f.NewObject(ctx, "locked.txt")
+	require.NoError(t, err)
+
+	info, in := testInfo("locked.txt", "new contents")
+	err = obj.Update(ctx, in, info)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read-only")
+	assert.Contains(t, err.Error(), "clear_read_only")
+
+	err = obj.Remove(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read-only")
+}
+
+// TestReadOnlyClearAndRetry checks that with clear_read_only set the
+// backend clears the flag via the management API and retries.
+func TestReadOnlyClearAndRetry(t *testing.T) {
+	z := newTestZone()
+	z.put("locked.txt", "old")
+	z.readOnly["locked.txt"] = true
+
+	// Fake management API which clears the read-only flag
+	mgmt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.Contains(t, r.URL.Path, "/read-only")
+		require.Equal(t, "mgmt-key", r.Header.Get("AccessKey"))
+		z.mu.Lock()
+		z.readOnly[path.Base(strings.TrimSuffix(r.URL.Path, "/read-only"))] = false
+		z.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mgmt.Close()
+
+	f := newTestFs(t, z, configmap.Simple{
+		"api_key":         "mgmt-key",
+		"clear_read_only": "true",
+	})
+	f.mgmt = rest.NewClient(f.httpClient).SetRoot(mgmt.URL).SetHeader("AccessKey", "mgmt-key").SetErrorHandler(errorHandler)
+	ctx := context.Background()
+
+	obj, err := f.NewObject(ctx, "locked.txt")
+	require.NoError(t, err)
+
+	info, in := testInfo("locked.txt", "new contents")
+	err = obj.Update(ctx, in, info)
+	require.NoError(t, err)
+
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "new contents", data)
+}
+
+// TestPurgeCacheCommand checks the purge-cache backend command sends
+// purge requests to the management API for the right pull zone URLs.
+func TestPurgeCacheCommand(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{
+		"api_key":            "mgmt-key",
+		"pull_zone_hostname": "cdn.example.com",
+	})
+	ctx := context.Background()
+
+	// Fake management API recording the purged URLs
+	var (
+		mu     sync.Mutex
+		purged []string
+	)
+	mgmt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.Equal(t, "/purge", r.URL.Path)
+		require.Equal(t, "mgmt-key", r.Header.Get("AccessKey"))
+		require.Equal(t, "false", r.URL.Query().Get("async"))
+		mu.Lock()
+		purged = append(purged, r.URL.Query().Get("url"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mgmt.Close()
+	f.mgmt = rest.NewClient(f.httpClient).SetRoot(mgmt.URL).SetHeader("AccessKey", "mgmt-key").SetErrorHandler(errorHandler)
+
+	// Explicit paths purge just those URLs
+	out, err := f.Command(ctx, "purge-cache", []string{"dir/page.html", "style.css"}, nil)
+	require.NoError(t, err)
+	result, ok := out.(purgeResult)
+	require.True(t, ok)
+	assert.Equal(t, []string{
+		"https://cdn.example.com/dir/page.html",
+		"https://cdn.example.com/style.css",
+	}, result.Purged)
+
+	// No path at all purges the whole zone with a wildcard
+	out, err = f.Command(ctx, "purge-cache", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://cdn.example.com/*"}, out.(purgeResult).Purged)
+
+	mu.Lock()
+	assert.Equal(t, []string{
+		"https://cdn.example.com/dir/page.html",
+		"https://cdn.example.com/style.css",
+		"https://cdn.example.com/*",
+	}, purged)
+	mu.Unlock()
+
+	// A remote pointing at a path purges that path's URL, no wildcard
+	sub := newTestFs(t, z, configmap.Simple{
+		"api_key":            "mgmt-key",
+		"pull_zone_hostname": "cdn.example.com",
+		"_root":              "site/index.html",
+	})
+	sub.mgmt = f.mgmt
+	out, err = sub.Command(ctx, "purge-cache", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://cdn.example.com/site/index.html"}, out.(purgeResult).Purged)
+
+	// Both config options are required
+	_, err = newTestFs(t, z, configmap.Simple{"pull_zone_hostname": "cdn.example.com"}).Command(ctx, "purge-cache", nil, nil)
+	require.ErrorContains(t, err, "api_key")
+	_, err = newTestFs(t, z, configmap.Simple{"api_key": "mgmt-key"}).Command(ctx, "purge-cache", nil, nil)
+	require.ErrorContains(t, err, "pull_zone_hostname")
+}
+
+// TestStatsCommand checks the stats backend command finds the zone in
+// the management API listing and reports its statistics.
+func TestStatsCommand(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"api_key": "mgmt-key"})
+	ctx := context.Background()
+
+	// Fake management API listing two zones, ours not first
+	mgmt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "GET", r.Method)
+		require.Equal(t, "/storagezone", r.URL.Path)
+		require.Equal(t, "mgmt-key", r.Header.Get("AccessKey"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"Id": 1, "Name": "otherzone", "Region": "DE", "StorageUsed": 1, "FilesStored": 1},
+			{"Id": 2, "Name": "testzone", "Region": "DE", "ReplicationRegions": ["NY", "SYD"],
+			 "StorageUsed": 1073741824, "FilesStored": 42}
+		]`))
+	}))
+	defer mgmt.Close()
+	f.mgmt = rest.NewClient(f.httpClient).SetRoot(mgmt.URL).SetHeader("AccessKey", "mgmt-key").SetErrorHandler(errorHandler)
+
+	out, err := f.Command(ctx, "stats", nil, nil)
+	require.NoError(t, err)
+	result, ok := out.(statsResult)
+	require.True(t, ok)
+	assert.Equal(t, "testzone", result.Zone)
+	assert.Equal(t, "DE", result.Region)
+	assert.Equal(t, []string{"NY", "SYD"}, result.ReplicationRegions)
+	assert.Equal(t, int64(1073741824), result.StorageUsed)
+	assert.Equal(t, "1Gi", result.StorageUsedHuman)
+	assert.Equal(t, int64(42), result.FilesStored)
+
+	// A zone missing from the account is a clear error
+	other := newTestFs(t, z, configmap.Simple{"api_key": "mgmt-key", "storage_zone": "ghostzone"})
+	other.mgmt = f.mgmt
+	_, err = other.Command(ctx, "stats", nil, nil)
+	require.ErrorContains(t, err, `"ghostzone" not found`)
+
+	// And so is a missing api_key
+	_, err = newTestFs(t, z, nil).Command(ctx, "stats", nil, nil)
+	require.ErrorContains(t, err, "api_key")
+}
+
+// idleClosingTransport counts CloseIdleConnections calls for
+// TestShutdownReleasesResources.
+type idleClosingTransport struct {
+	rt     http.RoundTripper
+	closed int
+}
+
+func (t *idleClosingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.rt.RoundTrip(req)
+}
+
+func (t *idleClosingTransport) CloseIdleConnections() { t.closed++ }
+
+// TestShutdownReleasesResources checks Shutdown clears the directory
+// cache, closes idle connections through the wrapped transport stack
+// and can be called more than once.
+func TestShutdownReleasesResources(t *testing.T) {
+	z := newTestZone()
+	z.put("a.txt", "contents")
+	// proactive_throttle wraps the transport, checking
+	// CloseIdleConnections is forwarded through the stack
+	f := newTestFs(t, z, configmap.Simple{"proactive_throttle": "true"})
+	ctx := context.Background()
+
+	// Splice a counting transport in under the wrappers so the test
+	// proves CloseIdleConnections is forwarded all the way down
+	metrics, ok := f.httpClient.Transport.(*metricsTransport)
+	require.True(t, ok, "metrics transport should be outermost")
+	throttle, ok := metrics.rt.(*throttleTransport)
+	require.True(t, ok, "throttle transport should wrap the base transport")
+	inner := &idleClosingTransport{rt: throttle.rt}
+	throttle.rt = inner
+
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+	_, ok = f.cache.Get("")
+	require.True(t, ok, "listing should be cached before Shutdown")
+
+	require.NoError(t, f.Shutdown(ctx))
+	_, ok = f.cache.Get("")
+	assert.False(t, ok, "Shutdown should clear the directory cache")
+	assert.Equal(t, 1, inner.closed, "Shutdown should close idle connections")
+
+	// Shutdown is idempotent
+	require.NoError(t, f.Shutdown(ctx))
+	assert.Equal(t, 2, inner.closed)
+}
+
+// TestDirCacheFlushCommand checks the dir-cache-flush backend command
+// forces a re-fetch for the flushed subtree while other cached
+// listings stay cached.
+func TestDirCacheFlushCommand(t *testing.T) {
+	z := newTestZone()
+	z.put("top.txt", "top")
+	z.put("dir/file.txt", "nested")
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	// Warm the cache for the root and for dir
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+	_, err = f.List(ctx, "dir")
+	require.NoError(t, err)
+	require.Equal(t, 1, z.countRequests("GET /testzone/dir/"))
+
+	// Cached listings don't hit the server again
+	_, err = f.List(ctx, "")
+	require.NoError(t, err)
+	_, err = f.List(ctx, "dir")
+	require.NoError(t, err)
+	assert.Equal(t, 1, z.countRequests("GET /testzone/dir/"))
+	assert.Equal(t, 2, z.countRequests("GET /testzone/"))
+
+	// Flushing just dir re-fetches dir but leaves the root cached
+	out, err := f.Command(ctx, "dir-cache-flush", []string{"dir"}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, out.(string), "1 directories")
+	_, err = f.List(ctx, "dir")
+	require.NoError(t, err)
+	_, err = f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, z.countRequests("GET /testzone/dir/"))
+	assert.Equal(t, 3, z.countRequests("GET /testzone/"))
+
+	// Flushing everything re-fetches the root too
+	out, err = f.Command(ctx, "dir-cache-flush", nil, nil)
+	require.NoError(t, err)
+	assert.Contains(t, out.(string), "whole directory cache")
+	_, err = f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 4, z.countRequests("GET /testzone/"))
+}
+
+// TestDownloadViaCDN checks that with download_via_cdn set Open
+// fetches from the pull zone, signs requests when token auth is
+// configured and falls back to the origin when the CDN returns 404.
+func TestDownloadViaCDN(t *testing.T) {
+	z := newTestZone()
+	z.put("file.txt", "origin contents")
+	z.put("fresh.txt", "origin fresh")
+
+	// Fake pull zone which has file.txt cached but not fresh.txt
+	var queries []url.Values
+	var mu sync.Mutex
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.Header.Get("AccessKey"), "CDN requests must not carry the storage access key")
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		if r.URL.Path != "/file.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("cdn contents"))
+	}))
+	defer cdn.Close()
+
+	f := newTestFs(t, z, configmap.Simple{
+		"download_via_cdn":   "true",
+		"pull_zone_hostname": cdn.URL,
+	})
+	ctx := context.Background()
+
+	// A CDN hit serves the CDN copy and never reads from the origin
+	obj, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "cdn contents", data)
+	assert.Equal(t, 0, z.countRequests("GET /testzone/file.txt"))
+
+	// A CDN miss falls back to the origin
+	obj, err = f.NewObject(ctx, "fresh.txt")
+	require.NoError(t, err)
+	rc, err = obj.Open(ctx)
+	require.NoError(t, err)
+	data, err = readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "origin fresh", data)
+	assert.Equal(t, 1, z.countRequests("GET /testzone/fresh.txt"))
+
+	// With token_auth_key the CDN request is signed
+	signed := newTestFs(t, z, configmap.Simple{
+		"download_via_cdn":   "true",
+		"pull_zone_hostname": cdn.URL,
+		"token_auth_key":     "secret",
+	})
+	obj, err = signed.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	rc, err = obj.Open(ctx)
+	require.NoError(t, err)
+	_, err = readAll(rc)
+	require.NoError(t, err)
+	mu.Lock()
+	last := queries[len(queries)-1]
+	mu.Unlock()
+	require.NotEmpty(t, last.Get("expires"))
+	sum := sha256.Sum256([]byte("secret" + "/file.txt" + last.Get("expires")))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), last.Get("token"))
+
+	// The option needs a pull zone to download from
+	_, err = NewFs(ctx, "TestBunny", "", configmap.Simple{
+		"storage_zone":     testZoneName,
+		"access_key":       testAccessKey,
+		"download_via_cdn": "true",
+	})
+	require.ErrorContains(t, err, "pull_zone_hostname")
+}
+
+// TestChunkedUpload checks the chunk writer spools chunks locally,
+// uploads the assembled object in one PUT with the usual headers and
+// cleans the spool file up.
+func TestChunkedUpload(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"chunk_size": "40b", "upload_concurrency": "2"})
+	ctx := context.Background()
+
+	content := strings.Repeat("0123456789", 10) // 100 bytes = 2 full chunks + remainder
+	chunks := []string{content[:40], content[40:80], content[80:]}
+
+	info, _ := testInfo("big.bin", content)
+	cwInfo, writer, err := f.OpenChunkWriter(ctx, "big.bin", info)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), cwInfo.ChunkSize)
+	assert.Equal(t, 2, cwInfo.Concurrency)
+	spoolName := writer.(*chunkWriter).spool.Name()
+
+	// Chunks may arrive in any order
+	for _, n := range []int{2, 0, 1} {
+		written, err := writer.WriteChunk(ctx, n, strings.NewReader(chunks[n]))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(chunks[n])), written)
+	}
+	// Nothing goes over the wire until Close
+	assert.Equal(t, 0, z.countRequests("PUT"))
+	require.NoError(t, writer.Close(ctx))
+	assert.Equal(t, 1, z.countRequests("PUT"))
+
+	obj, err := f.NewObject(ctx, "big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), obj.Size())
+	// The single PUT carried the usual headers - the mtime must not be
+	// lost, or SetModTime would re-upload the whole object afterwards
+	assert.Equal(t, info.ModTime(ctx), obj.ModTime(ctx).UTC())
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+	wantSum := sha256.Sum256([]byte(content))
+	sum, err := obj.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(wantSum[:]), sum)
+
+	// The spool file is gone
+	_, err = os.Stat(spoolName)
+	assert.True(t, os.IsNotExist(err))
+
+	// A gap in the chunk numbers refuses to assemble
+	_, writer, err = f.OpenChunkWriter(ctx, "gappy.bin", info)
+	require.NoError(t, err)
+	spoolName = writer.(*chunkWriter).spool.Name()
+	_, err = writer.WriteChunk(ctx, 1, strings.NewReader("data"))
+	require.NoError(t, err)
+	require.ErrorContains(t, writer.Close(ctx), "chunk 0 was never written")
+
+	// Abort removes the spool without writing the final object
+	require.NoError(t, writer.Abort(ctx))
+	_, err = os.Stat(spoolName)
+	assert.True(t, os.IsNotExist(err))
+	_, err = f.NewObject(ctx, "gappy.bin")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
+
+// TestUnknownSizeUpload checks that a streaming upload with unknown
+// size (as rcat produces) is spooled, uploaded with the real length
+// and checksum and reports the actual size afterwards.
+func TestUnknownSizeUpload(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	content := "streamed without a known length"
+	info := object.NewStaticObjectInfo("stream.txt", time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), -1, true, nil, nil)
+	// A plain reader with no Seek, like a pipe
+	in := io.LimitReader(strings.NewReader(content), int64(len(content)))
+
+	obj, err := f.Put(ctx, in, info)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), obj.Size(), "Put should report the bytes actually written")
+
+	wantSum := sha256.Sum256([]byte(content))
+	sum, err := obj.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(wantSum[:]), sum)
+
+	// The stored object is complete and a fresh lookup sizes it right
+	assert.Equal(t, content, string(z.objects["stream.txt"].data))
+	fresh, err := f.NewObject(ctx, "stream.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), fresh.Size())
+	rc, err := fresh.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
+
+// TestZeroByteFile checks an empty file uploads with an explicit
+// Content-Length of 0, lists as a file and round-trips through
+// NewObject and Open.
+func TestZeroByteFile(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx := context.Background()
+
+	// Capture how the PUT went over the wire
+	var contentLength int64 = -2
+	var transferEncoding []string
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/empty.txt") {
+			contentLength = r.ContentLength
+			transferEncoding = r.TransferEncoding
+		}
+		return false
+	}
+
+	obj := putTestFile(t, f, "empty.txt", "")
+	assert.Equal(t, int64(0), obj.Size())
+	assert.Equal(t, int64(0), contentLength, "empty upload should carry Content-Length: 0")
+	assert.Empty(t, transferEncoding, "empty upload should not be chunked")
+
+	// Stored as a file, not mistaken for a directory marker
+	require.Contains(t, z.objects, "empty.txt")
+	assert.NotContains(t, z.dirs, "empty.txt")
+
+	f.cache.ClearAll()
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	_, isObject := entries[0].(fs.Object)
+	require.True(t, isObject, "empty file should list as a file")
+	assert.Equal(t, int64(0), entries[0].Size())
+
+	fresh, err := f.NewObject(ctx, "empty.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), fresh.Size())
+	rc, err := fresh.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+// TestStandardMetadataKeys checks the standard metadata keys round
+// trip: mtime and content-type from the metadata map beat the
+// source's own values and come back from Metadata, and a key like
+// mode survives as user metadata.
+func TestStandardMetadataKeys(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, nil)
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Metadata = true
+
+	features := f.Features()
+	assert.True(t, features.ReadMetadata)
+	assert.True(t, features.WriteMetadata)
+	assert.True(t, features.UserMetadata)
+
+	metaTime := time.Date(2023, 11, 12, 13, 14, 15, 0, time.UTC)
+	meta := fs.Metadata{
+		"mtime":        metaTime.Format(time.RFC3339Nano),
+		"content-type": "application/x-custom",
+		"mode":         "0644",
+	}
+	content := "metadata carrier"
+	in := bytes.NewReader([]byte(content))
+	info := object.NewStaticObjectInfo("meta.bin", time.Now(), int64(len(content)), true, nil, nil).WithMetadata(meta)
+	obj, err := f.Put(ctx, in, info)
+	require.NoError(t, err)
+
+	// The metadata mtime wins over the source ModTime
+	assert.True(t, metaTime.Equal(obj.ModTime(ctx)), "got %v", obj.ModTime(ctx))
+
+	got, err := obj.(*Object).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, meta["mtime"], got["mtime"])
+	assert.Equal(t, "application/x-custom", got["content-type"])
+	assert.Equal(t, "0644", got["mode"])
+
+	// A fresh lookup reads the same values back from storage
+	f.cache.ClearAll()
+	fresh, err := f.NewObject(ctx, "meta.bin")
+	require.NoError(t, err)
+	assert.True(t, metaTime.Equal(fresh.ModTime(ctx)), "got %v", fresh.ModTime(ctx))
+	got, err = fresh.(*Object).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-custom", got["content-type"])
+	assert.Equal(t, "0644", got["mode"])
+}
+
+// TestDisableChecksum checks that with disable_checksum set uploads
+// carry no Checksum header and the backend stops advertising SHA256.
+func TestDisableChecksum(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"disable_checksum": "true"})
+
+	var checksums []string
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" {
+			checksums = append(checksums, r.Header.Get("Checksum"))
+		}
+		return false
+	}
+
+	// A source which knows its SHA256
+	content := "contents"
+	sum := sha256.Sum256([]byte(content))
+	hashes := map[hash.Type]string{hash.SHA256: hex.EncodeToString(sum[:])}
+	ctx := context.Background()
+
+	info := object.NewStaticObjectInfo("nohash.txt", time.Now(), int64(len(content)), true, hashes, nil)
+	_, err := f.Put(ctx, bytes.NewReader([]byte(content)), info)
+	require.NoError(t, err)
+	require.NotEmpty(t, checksums)
+	for _, sent := range checksums {
+		assert.Empty(t, sent, "no Checksum header should be sent with disable_checksum")
+	}
+	assert.Equal(t, hash.Set(hash.None), f.Hashes())
+
+	// The default sends the source hash and advertises SHA256
+	f2 := newTestFs(t, z, nil)
+	checksums = nil
+	info = object.NewStaticObjectInfo("hashed.txt", time.Now(), int64(len(content)), true, hashes, nil)
+	_, err = f2.Put(ctx, bytes.NewReader([]byte(content)), info)
+	require.NoError(t, err)
+	require.NotEmpty(t, checksums)
+	assert.Equal(t, strings.ToUpper(hex.EncodeToString(sum[:])), checksums[0])
+	assert.Equal(t, hash.Set(hash.SHA256), f2.Hashes())
+}
+
+// TestVerifyDownload checks the streaming download verification: a
+// clean full read passes, a corrupted body fails at EOF and a ranged
+// read skips verification.
+func TestVerifyDownload(t *testing.T) {
+	z := newTestZone()
+	z.put("good.txt", "intact contents")
+	f := newTestFs(t, z, configmap.Simple{"verify_download": "true"})
+	ctx := context.Background()
+
+	// A full read of intact content verifies silently
+	obj, err := f.NewObject(ctx, "good.txt")
+	require.NoError(t, err)
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "intact contents", data)
+
+	// Corrupt the body in transit - the stored checksum stands
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/good.txt") {
+			body := []byte("mangled contents")
+			sum := sha256.Sum256([]byte("intact contents"))
+			w.Header().Set("Checksum", strings.ToUpper(hex.EncodeToString(sum[:])))
+			if rng := r.Header.Get("Range"); rng != "" {
+				serveRange(w, rng, body)
+				return true
+			}
+			_, _ = w.Write(body)
+			return true
+		}
+		return false
+	}
+	rc, err = obj.Open(ctx)
+	require.NoError(t, err)
+	_, err = io.ReadAll(rc)
+	require.ErrorContains(t, err, "corrupted download")
+	require.NoError(t, rc.Close())
+
+	// A ranged read of the corrupted body is returned unverified
+	rc, err = obj.Open(ctx, &fs.RangeOption{Start: 0, End: 6})
+	require.NoError(t, err)
+	data, err = readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "mangled", data)
+}
+
+// TestUserAgent checks the user_agent option is sent on listing,
+// upload and download requests, and that rclone's standard user agent
+// is left alone when the option is unset.
+func TestUserAgent(t *testing.T) {
+	z := newTestZone()
+
+	var mu sync.Mutex
+	agents := map[string]string{}
+	z.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		agents[r.Method] = r.Header.Get("User-Agent")
+		mu.Unlock()
+		return false
+	}
+
+	f := newTestFs(t, z, configmap.Simple{"user_agent": "my-agent/1.0"})
+	ctx := context.Background()
+
+	obj := putTestFile(t, f, "ua.txt", "contents")
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	_, err = readAll(rc)
+	require.NoError(t, err)
+
+	mu.Lock()
+	for _, method := range []string{"PUT", "GET"} {
+		assert.Equal(t, "my-agent/1.0", agents[method], method)
+	}
+	agents = map[string]string{}
+	mu.Unlock()
+
+	// Without the option the transport's standard rclone user agent
+	// goes out untouched
+	f = newTestFs(t, z, nil)
+	_, err = f.List(ctx, "")
+	require.NoError(t, err)
+	mu.Lock()
+	assert.Contains(t, agents["GET"], "rclone", "default user agent should be rclone's")
+	mu.Unlock()
+}
+
+// TestRootIsFile checks NewFs detects a root pointing at an existing
+// file, handing back an Fs on the parent with fs.ErrorIsFile.
+func TestRootIsFile(t *testing.T) {
+	z := newTestZone()
+	z.put("dir/file.txt", "contents")
+	ts := httptest.NewServer(z)
+	t.Cleanup(ts.Close)
+	conf := func() configmap.Simple {
+		return configmap.Simple{
+			"storage_zone":     testZoneName,
+			"access_key":       testAccessKey,
+			"list_cache_time":  listCacheTTL.String(),
+			"encoding":         defaultEncoding.String(),
+			"storage_endpoint": ts.URL,
+		}
+	}
+	ctx := context.Background()
+
+	// A root pointing at a file comes back rooted on the parent
+	fsys, err := NewFs(ctx, "TestBunny", "dir/file.txt", conf())
+	require.Equal(t, fs.ErrorIsFile, err)
+	require.NotNil(t, fsys)
+	f := fsys.(*Fs)
+	assert.Equal(t, "dir", f.root)
+	obj, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("contents")), obj.Size())
+
+	// A root pointing at a directory is kept as configured
+	fsys, err = NewFs(ctx, "TestBunny", "dir", conf())
+	require.NoError(t, err)
+	assert.Equal(t, "dir", fsys.(*Fs).root)
+
+	// So is a root that doesn't exist yet
+	fsys, err = NewFs(ctx, "TestBunny", "dir/brand/new", conf())
+	require.NoError(t, err)
+	assert.Equal(t, "dir/brand/new", fsys.(*Fs).root)
+}
+
+// TestPackConcurrentReadRemove checks listings can expand pack
+// objects while other goroutines remove packed files - the decoded
+// documents are shared, so rewrites must never mutate them in place.
+func TestPackConcurrentReadRemove(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"pack_small_files": "1Ki"})
+	ctx := context.Background()
+
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("f%d.txt", i)
+		src := object.NewStaticObjectInfo(name, time.Now(), 1, true, nil, nil)
+		_, err := f.Put(ctx, strings.NewReader("x"), src)
+		require.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		n := i
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			obj, err := f.NewObject(ctx, fmt.Sprintf("f%d.txt", n))
+			if assert.NoError(t, err) {
+				assert.NoError(t, obj.Remove(ctx))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = f.List(ctx, "")
+		}()
+	}
+	wg.Wait()
+
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(entries))
+}
+
+// TestPackTransitions checks that a packed name never ends up stored
+// twice: SetModTime rewrites the entry inside its pack, and a Put
+// that has grown past the pack threshold drops the old packed copy.
+func TestPackTransitions(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"pack_small_files": "1Ki"})
+	ctx := context.Background()
+	putTestFile(t, f, "grow.txt", "small for now")
+
+	// SetModTime keeps the file in its pack with the new timestamp
+	obj, err := f.NewObject(ctx, "grow.txt")
+	require.NoError(t, err)
+	want := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, obj.SetModTime(ctx, want))
+	obj, err = f.NewObject(ctx, "grow.txt")
+	require.NoError(t, err)
+	assert.True(t, want.Equal(obj.ModTime(ctx)))
+	z.mu.Lock()
+	_, individual := z.objects["grow.txt"]
+	z.mu.Unlock()
+	assert.False(t, individual, "SetModTime must not turn a packed file into an individual object")
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	// A Put over the pack threshold replaces the packed copy
+	big := strings.Repeat("x", 2048)
+	info, in := testInfo("grow.txt", big)
+	_, err = f.Put(ctx, in, info)
+	require.NoError(t, err)
+	entries, err = f.List(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, int64(len(big)), entries[0].(*Object).Size())
+	obj, err = f.NewObject(ctx, "grow.txt")
+	require.NoError(t, err)
+	assert.False(t, obj.(*Object).packed)
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, big, data)
+}
+
+// TestPackCopyMove checks that Copy and Move of a packed file return
+// the sentinel errors - a packed file has no individual object to
+// stream from, so the sync engine must fall back to Open.
+func TestPackCopyMove(t *testing.T) {
+	z := newTestZone()
+	f := newTestFs(t, z, configmap.Simple{"pack_small_files": "1Ki"})
+	ctx := context.Background()
+	putTestFile(t, f, "small.txt", "packed contents")
+
+	obj, err := f.NewObject(ctx, "small.txt")
+	require.NoError(t, err)
+	_, err = f.Copy(ctx, obj, "copied.txt")
+	assert.Equal(t, fs.ErrorCantCopy, err)
+	_, err = f.Move(ctx, obj, "moved.txt")
+	assert.Equal(t, fs.ErrorCantMove, err)
+
+	// The source is untouched by the refusals
+	readBack := func(name, want string) {
+		o, err := f.NewObject(ctx, name)
+		require.NoError(t, err)
+		rc, err := o.Open(ctx)
+		require.NoError(t, err)
+		data, err := readAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, want, data)
+	}
+	readBack("small.txt", "packed contents")
+}
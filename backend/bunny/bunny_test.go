@@ -0,0 +1,17 @@
+// Test Bunny filesystem interface
+package bunny_test
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/backend/bunny"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: "TestBunny:",
+		NilObject:  (*bunny.Object)(nil),
+	})
+}
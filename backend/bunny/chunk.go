@@ -0,0 +1,200 @@
+// Chunked upload of large files.
+//
+// A mid-transfer failure of a plain streaming PUT starts the whole
+// upload over, re-reading the source. bunny has no multipart upload
+// endpoint, so the chunk writer spools chunk_size pieces of the
+// source into a local temporary file - written in any order, with
+// upload_concurrency parallel reads of the source - and sends the
+// assembled file in one PUT on Close, with the same mtime,
+// Content-Type and metadata headers every other write path sends. A
+// failed chunk is re-read from the source on its own, and the final
+// PUT can be re-sent from the spool without touching the source.
+
+package bunny
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+const (
+	// defaultChunkSize is the chunk_size default
+	defaultChunkSize = 64 * fs.Mebi
+	// defaultUploadConcurrency is the upload_concurrency default
+	defaultUploadConcurrency = 4
+)
+
+// chunkWriter spools the chunks of one file locally and uploads the
+// assembled result on Close. It implements fs.ChunkWriter.
+type chunkWriter struct {
+	f         *Fs
+	remote    string
+	src       fs.ObjectInfo
+	options   []fs.OpenOption
+	chunkSize int64
+	spool     *os.File
+
+	mu    sync.Mutex
+	parts map[int]int64 // chunk number -> size written
+}
+
+// OpenChunkWriter returns the chunk size and a ChunkWriter for remote
+func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, options ...fs.OpenOption) (fs.ChunkWriterInfo, fs.ChunkWriter, error) {
+	chunkSize := int64(f.opt.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = int64(defaultChunkSize)
+	}
+	concurrency := f.opt.UploadConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultUploadConcurrency
+	}
+	info := fs.ChunkWriterInfo{
+		ChunkSize:   chunkSize,
+		Concurrency: concurrency,
+	}
+	spool, err := os.CreateTemp("", "rclone-bunny-chunked-")
+	if err != nil {
+		return info, nil, fmt.Errorf("failed to create spool file for chunked upload of %q: %w", remote, err)
+	}
+	writer := &chunkWriter{
+		f:         f,
+		remote:    remote,
+		src:       src,
+		options:   options,
+		chunkSize: chunkSize,
+		spool:     spool,
+		parts:     map[int]int64{},
+	}
+	return info, writer, nil
+}
+
+// WriteChunk writes chunk chunkNumber to its offset in the spool
+// file. Chunks may arrive in any order and concurrently.
+func (w *chunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (int64, error) {
+	size, err := io.Copy(io.NewOffsetWriter(w.spool, int64(chunkNumber)*w.chunkSize), reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to spool chunk %d of %q: %w", chunkNumber, w.remote, err)
+	}
+	w.mu.Lock()
+	w.parts[chunkNumber] = size
+	w.mu.Unlock()
+	return size, nil
+}
+
+// Close uploads the spooled file as the final object and removes the
+// spool
+func (w *chunkWriter) Close(ctx context.Context) (err error) {
+	defer w.removeSpool()
+	w.mu.Lock()
+	numbers := make([]int, 0, len(w.parts))
+	var totalSize int64
+	for n, size := range w.parts {
+		numbers = append(numbers, n)
+		totalSize += size
+	}
+	w.mu.Unlock()
+	sort.Ints(numbers)
+	for i, n := range numbers {
+		if i != n {
+			return fmt.Errorf("can't assemble %q: chunk %d was never written", w.remote, i)
+		}
+		if n != len(numbers)-1 && w.parts[n] != w.chunkSize {
+			return fmt.Errorf("can't assemble %q: chunk %d is %d bytes instead of %d", w.remote, n, w.parts[n], w.chunkSize)
+		}
+	}
+	srcHash := ""
+	if !w.f.opt.DisableChecksum {
+		hasher := sha256.New()
+		if _, err := w.spool.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(hasher, io.LimitReader(w.spool, totalSize)); err != nil {
+			return fmt.Errorf("failed to hash spooled upload of %q: %w", w.remote, err)
+		}
+		srcHash = hex.EncodeToString(hasher.Sum(nil))
+	}
+	// Send the same headers Update sends so the assembled object keeps
+	// its modification time, content type and metadata
+	meta, err := fs.GetMetadataOptions(ctx, w.f, w.src, w.options)
+	if err != nil {
+		return err
+	}
+	xattrs, sidecar, err := serializeMetadata(userMetadata(meta))
+	if err != nil {
+		return err
+	}
+	contentType := fs.MimeType(ctx, w.src)
+	if ct := meta["content-type"]; ct != "" {
+		contentType = ct
+	}
+	modTime := w.src.ModTime(ctx)
+	if v := meta["mtime"]; v != "" {
+		if metaTime, parseErr := time.Parse(time.RFC3339Nano, v); parseErr == nil {
+			modTime = metaTime
+		} else {
+			fs.Debugf(w.f, "ignoring invalid mtime metadata %q: %v", v, parseErr)
+		}
+	}
+	headers := map[string]string{
+		mtimeHeader:    modTime.UTC().Format(time.RFC3339Nano),
+		"Content-Type": contentType,
+	}
+	if xattrs != "" && !sidecar {
+		headers[xattrHeader] = xattrs
+	}
+	resp, err := w.f.upload(ctx, w.remote, io.NewSectionReader(w.spool, 0, totalSize), totalSize, srcHash, headers)
+	if err != nil {
+		return fmt.Errorf("failed to upload %q: %w", w.remote, err)
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to upload %q: %w", w.remote, uploadStatusErr(resp))
+	}
+	if serverHash := strings.ToLower(resp.Header.Get("Checksum")); srcHash != "" && serverHash != "" && serverHash != srcHash {
+		return fmt.Errorf("upload integrity check failed for %q: sent SHA256 %s but server stored %s", w.remote, srcHash, serverHash)
+	}
+	if err := w.f.updateSidecar(ctx, w.remote, xattrs, sidecar, meta != nil); err != nil {
+		return err
+	}
+	w.f.recordManifestEntry(w.remote, totalSize, srcHash)
+	w.f.recordRecentWrite(w.remote)
+	w.f.refreshCacheEntry(ctx, w.remote)
+	return nil
+}
+
+// Abort throws the spooled chunks away. Nothing has touched the zone
+// yet, so there is nothing remote to clean up.
+func (w *chunkWriter) Abort(ctx context.Context) error {
+	w.removeSpool()
+	return nil
+}
+
+// removeSpool closes and deletes the spool file
+func (w *chunkWriter) removeSpool() {
+	if w.spool == nil {
+		return
+	}
+	name := w.spool.Name()
+	_ = w.spool.Close()
+	if err := os.Remove(name); err != nil {
+		fs.Errorf(w.f, "failed to remove chunked upload spool file %q: %v", name, err)
+	}
+	w.spool = nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.OpenChunkWriter = (*Fs)(nil)
+	_ fs.ChunkWriter     = (*chunkWriter)(nil)
+)
@@ -0,0 +1,740 @@
+// Backend commands for the bunny backend
+package bunny
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/backend/bunny/api"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/rest"
+	"golang.org/x/sync/errgroup"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "upload-benchmark",
+	Short: "Measure upload throughput to the storage zone.",
+	Long: `This command uploads a payload of random data, measures the
+throughput, then deletes the test object again.
+
+Usage Examples:
+
+    rclone backend upload-benchmark remote: [-o size=SIZE] [-o remote=PATH]
+    rclone backend upload-benchmark remote: -o size=1Mi,10Mi,100Mi
+
+"size" is the payload size and may be a comma separated list, in which
+case each size is benchmarked in turn. "remote" is the path the test
+object is uploaded to. The upload goes through the normal single PUT
+upload path so the measured rate reflects real transfers.
+`,
+	Opts: map[string]string{
+		"size":   "Payload size or comma separated list of sizes (default 10Mi).",
+		"remote": "Path to upload the test object to (default .rclone-benchmark).",
+	},
+}, {
+	Name:  "scrub",
+	Short: "Verify the integrity of every object under the remote.",
+	Long: `This command walks the remote recursively, downloads each object,
+recomputes its SHA256 and compares it to the checksum the zone has
+stored, reporting any objects whose content doesn't match.
+
+Usage Examples:
+
+    rclone backend scrub remote: [-o concurrency=N] [-o state-file=FILE]
+
+"concurrency" bounds how many objects are verified in parallel,
+defaulting to the scrub_concurrency option (itself 4 by default).
+Objects are streamed through the hash as they download, so memory use
+stays bounded regardless of object size. With "state-file" set, verified paths are recorded in the
+file and skipped on a re-run, so an interrupted scrub of a large zone
+can be resumed. The state file is removed when a scrub finishes with
+no corruptions; after a scrub which found corruptions a re-run
+verifies just the corrupted objects again.
+`,
+	Opts: map[string]string{
+		"concurrency": "How many objects to verify in parallel (default scrub_concurrency).",
+		"state-file":  "Local file recording already verified paths for resumption.",
+	},
+}, {
+	Name:  "export",
+	Short: "Export the remote as a single tar or zip archive.",
+	Long: `This command walks the remote recursively and writes every object
+into one archive, streaming each download straight into it.
+
+Usage Examples:
+
+    rclone backend export remote:path -o target=/tmp/backup.tar
+    rclone backend export remote:path -o format=zip -o target=/tmp/backup.zip
+    rclone backend export remote:path -o target=- > backup.tar
+
+"format" is "tar" (the default) or "zip". "target" is the local file
+to write the archive to, or "-" (the default) to stream it to
+standard output. Entries are written in sorted path order so repeated
+exports of unchanged data produce identical archives.
+`,
+	Opts: map[string]string{
+		"format": `Archive format, "tar" (default) or "zip".`,
+		"target": `Local file to write to, or "-" for stdout (default).`,
+	},
+}, {
+	Name:  "health-check",
+	Short: "Probe storage endpoints and report their latency.",
+	Long: `This command sends a lightweight listing request to the configured
+storage endpoint (and any extra endpoints given) and reports the
+status and latency of each, ranked fastest first, to help pick the
+best region for a high-availability setup.
+
+Usage Examples:
+
+    rclone backend health-check remote:
+    rclone backend health-check remote: -o endpoints=https://ny.storage.bunnycdn.com,https://la.storage.bunnycdn.com
+    rclone backend health-check remote: -o count=5
+
+"endpoints" is a comma separated list of extra endpoints to probe
+alongside the configured one. "count" is how many probes to send per
+endpoint (default 3) - the reported latency is the best of them, which
+filters out connection setup costs.
+`,
+	Opts: map[string]string{
+		"endpoints": "Comma separated extra endpoints to probe as well.",
+		"count":     "Probes per endpoint, reporting the fastest (default 3).",
+	},
+}, {
+	Name:  "purge-cache",
+	Short: "Purge the attached pull zone's edge cache.",
+	Long: `This command purges the CDN cache of the pull zone configured with
+pull_zone_hostname, so visitors see fresh content after files have
+been updated. It goes through the Bunny.net management API and so
+needs api_key to be set as well.
+
+Usage Examples:
+
+    rclone backend purge-cache remote:path/to/file
+    rclone backend purge-cache remote: file1.txt dir/file2.txt
+    rclone backend purge-cache remote:
+
+With a path to a file, just that file's URL is purged. Extra
+arguments are further paths to purge, relative to the remote. With
+no path at all the whole zone is purged with a wildcard.
+`,
+}, {
+	Name:  "dir-cache-flush",
+	Short: "Flush the cached directory listings.",
+	Long: `This command drops cached directory listings so the next List
+re-fetches from the storage zone, which is handy when files have been
+changed out-of-band through the Bunny dashboard.
+
+Usage Examples:
+
+    rclone backend dir-cache-flush remote:
+    rclone backend dir-cache-flush remote: some/dir
+
+With no argument the whole cache is flushed. With path arguments just
+those directories and everything below them are flushed.
+`,
+}, {
+	Name:  "stats",
+	Short: "Fetch storage zone statistics from the management API.",
+	Long: `This command looks the storage zone up through the Bunny.net
+management API and reports its statistics: storage used, number of
+files stored, the main region and which regions the zone replicates
+to. It needs api_key to be set.
+
+Usage Examples:
+
+    rclone backend stats remote:
+`,
+}, {
+	Name:  "raw",
+	Short: "Issue an arbitrary authenticated request to the storage endpoint.",
+	Long: `This is a debugging tool: it sends exactly the request you specify,
+with the remote's configured auth, and returns the status code and
+response body. It bypasses the retry, pacing and caching machinery,
+and nothing stops you deleting or overwriting data with it - prefer
+the normal commands for anything but poking at the API.
+
+Usage Examples:
+
+    rclone backend raw remote: GET /myzone/dir/
+    rclone backend raw remote: DELETE /myzone/old.txt
+    rclone backend raw remote: PUT /myzone/new.txt -o body='contents'
+
+The first argument is the HTTP method and the second the path
+relative to the storage endpoint (so it includes the zone name).
+`,
+	Opts: map[string]string{
+		"body":         "Request body to send, if any.",
+		"content-type": "Content-Type header for the request body.",
+	},
+}}
+
+// benchmarkResult is the outcome of a single benchmark upload
+type benchmarkResult struct {
+	Size           int64   `json:"size"`
+	Seconds        float64 `json:"seconds"`
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+	Speed          string  `json:"speed"`
+}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "upload-benchmark":
+		return f.uploadBenchmark(ctx, opt)
+	case "scrub":
+		return f.scrub(ctx, opt)
+	case "export":
+		return f.export(ctx, opt)
+	case "health-check":
+		return f.healthCheck(ctx, opt)
+	case "purge-cache":
+		return f.purgeCache(ctx, arg)
+	case "stats":
+		return f.stats(ctx)
+	case "dir-cache-flush":
+		return f.dirCacheFlush(arg)
+	case "raw":
+		return f.raw(ctx, arg, opt)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// scrubResult is the outcome of a scrub command
+type scrubResult struct {
+	Scanned         int      `json:"scanned"`
+	Skipped         int      `json:"skipped"`
+	MissingChecksum int      `json:"missingChecksum"`
+	Corrupted       []string `json:"corrupted"`
+}
+
+// scrub implements the scrub command
+func (f *Fs) scrub(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	concurrency := f.opt.ScrubConcurrency
+	if concurrency < 1 {
+		concurrency = 4
+	}
+	if s := opt["concurrency"]; s != "" {
+		concurrency, err = strconv.Atoi(s)
+		if err != nil || concurrency < 1 {
+			return nil, fmt.Errorf("invalid concurrency %q", s)
+		}
+	}
+	state, err := openProgressState(opt["state-file"])
+	if err != nil {
+		return nil, err
+	}
+	defer state.Close()
+	var (
+		mu     sync.Mutex
+		result scrubResult
+	)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	err = f.ListR(ctx, "", func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(*Object)
+			if !ok {
+				continue
+			}
+			if state.Done(o.Remote()) {
+				mu.Lock()
+				result.Skipped++
+				mu.Unlock()
+				continue
+			}
+			g.Go(func() error {
+				ok, scrubErr := f.scrubObject(gCtx, o)
+				mu.Lock()
+				defer mu.Unlock()
+				if scrubErr != nil {
+					return scrubErr
+				}
+				result.Scanned++
+				if o.sha256 == "" {
+					result.MissingChecksum++
+					return nil
+				}
+				if !ok {
+					fs.Errorf(f, "scrub: %q is corrupted - content doesn't match the stored checksum", o.Remote())
+					result.Corrupted = append(result.Corrupted, o.Remote())
+					return nil
+				}
+				state.MarkDone(o.Remote())
+				return nil
+			})
+		}
+		return nil
+	})
+	if waitErr := g.Wait(); err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result.Corrupted)
+	if len(result.Corrupted) == 0 {
+		// A clean complete scrub - the next one starts fresh
+		if err := state.Remove(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// scrubObject downloads o and reports whether its content matches the
+// stored checksum. Objects without a stored checksum report true.
+func (f *Fs) scrubObject(ctx context.Context, o *Object) (ok bool, err error) {
+	if o.sha256 == "" {
+		return true, nil
+	}
+	rc, err := o.Open(ctx)
+	if err != nil {
+		return false, fmt.Errorf("scrub: failed to open %q: %w", o.Remote(), err)
+	}
+	defer fs.CheckClose(rc, &err)
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, rc); err != nil {
+		return false, fmt.Errorf("scrub: failed to read %q: %w", o.Remote(), err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)) == o.sha256, nil
+}
+
+// exportResult is the outcome of an export command
+type exportResult struct {
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+	Format string `json:"format"`
+	Target string `json:"target"`
+}
+
+// export implements the export command
+func (f *Fs) export(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	format := opt["format"]
+	if format == "" {
+		format = "tar"
+	}
+	if format != "tar" && format != "zip" {
+		return nil, fmt.Errorf("invalid format %q: must be tar or zip", format)
+	}
+	target := opt["target"]
+	if target == "" {
+		target = "-"
+	}
+	var w io.Writer = os.Stdout
+	if target != "-" {
+		file, err := os.Create(target)
+		if err != nil {
+			return nil, err
+		}
+		defer fs.CheckClose(file, &err)
+		w = file
+	}
+	// Collect and sort first so repeated exports of unchanged data
+	// produce identical archives
+	var objs []*Object
+	err = f.ListR(ctx, "", func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			if o, ok := entry.(*Object); ok {
+				objs = append(objs, o)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].remote < objs[j].remote })
+	result := exportResult{Format: format, Target: target}
+	writeEntry := func(o *Object, archive io.Writer) error {
+		rc, err := o.Open(ctx)
+		if err != nil {
+			return fmt.Errorf("export: failed to open %q: %w", o.remote, err)
+		}
+		n, err := io.Copy(archive, rc)
+		closeErr := rc.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("export: failed to read %q: %w", o.remote, err)
+		}
+		result.Files++
+		result.Bytes += n
+		return nil
+	}
+	switch format {
+	case "tar":
+		tw := tar.NewWriter(w)
+		for _, o := range objs {
+			hdr := &tar.Header{
+				Name:    o.remote,
+				Size:    o.size,
+				Mode:    0644,
+				ModTime: o.modTime,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return nil, err
+			}
+			if err := writeEntry(o, tw); err != nil {
+				return nil, err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return nil, err
+		}
+	case "zip":
+		zw := zip.NewWriter(w)
+		for _, o := range objs {
+			hdr := &zip.FileHeader{
+				Name:     o.remote,
+				Method:   zip.Deflate,
+				Modified: o.modTime,
+			}
+			hdr.SetMode(0644)
+			archive, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return nil, err
+			}
+			if err := writeEntry(o, archive); err != nil {
+				return nil, err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// rawResult is the outcome of a raw command
+type rawResult struct {
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+}
+
+// raw implements the raw command, a debugging tool issuing exactly
+// the request specified with the configured auth and no retries,
+// pacing or caching in the way.
+func (f *Fs) raw(ctx context.Context, arg []string, opt map[string]string) (interface{}, error) {
+	if len(arg) != 2 {
+		return nil, fmt.Errorf("need a method and a path, eg: rclone backend raw remote: GET /%s/dir/", f.opt.StorageZone)
+	}
+	method := strings.ToUpper(arg[0])
+	p := arg[1]
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	var body io.Reader
+	if s, ok := opt["body"]; ok {
+		body = strings.NewReader(s)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, f.endpoint+p, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("AccessKey", f.opt.AccessKey)
+	if ct := opt["content-type"]; ct != "" {
+		req.Header.Set("Content-Type", ct)
+	}
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return rawResult{Status: resp.StatusCode, Body: string(b)}, nil
+}
+
+// healthResult is the outcome of probing one endpoint
+type healthResult struct {
+	Endpoint string  `json:"endpoint"`
+	Status   string  `json:"status"`
+	Code     int     `json:"code,omitempty"`
+	Millis   float64 `json:"millis"`
+}
+
+// probeEndpoint sends one listing request to endpoint and reports how
+// it went and how long it took.
+func (f *Fs) probeEndpoint(ctx context.Context, endpoint string) healthResult {
+	res := healthResult{Endpoint: endpoint}
+	url := endpoint + "/" + f.dirPath("")
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		res.Status = err.Error()
+		return res
+	}
+	req.Header.Set("AccessKey", f.opt.AccessKey)
+	start := time.Now()
+	resp, err := f.httpClient.Do(req)
+	res.Millis = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		res.Status = err.Error()
+		return res
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	res.Code = resp.StatusCode
+	if resp.StatusCode == http.StatusOK {
+		res.Status = "ok"
+	} else {
+		res.Status = resp.Status
+	}
+	return res
+}
+
+// healthCheck implements the health-check command
+func (f *Fs) healthCheck(ctx context.Context, opt map[string]string) (interface{}, error) {
+	count := 3
+	if s := opt["count"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid count %q: must be a positive integer", s)
+		}
+		count = n
+	}
+	endpoints := []string{f.endpoint}
+	if s := opt["endpoints"]; s != "" {
+		for _, endpoint := range strings.Split(s, ",") {
+			endpoint = strings.TrimSuffix(strings.TrimSpace(endpoint), "/")
+			if endpoint != "" && endpoint != f.endpoint {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+	results := make([]healthResult, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		best := f.probeEndpoint(ctx, endpoint)
+		for i := 1; i < count; i++ {
+			probe := f.probeEndpoint(ctx, endpoint)
+			if probe.Status == "ok" && (best.Status != "ok" || probe.Millis < best.Millis) {
+				best = probe
+			}
+		}
+		results = append(results, best)
+	}
+	// Rank healthy endpoints fastest first and failed ones last so the
+	// top of the report is the endpoint worth configuring
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Status == "ok") != (results[j].Status == "ok") {
+			return results[i].Status == "ok"
+		}
+		return results[i].Millis < results[j].Millis
+	})
+	return results, nil
+}
+
+// purgeResult is the outcome of a purge-cache command
+type purgeResult struct {
+	Purged []string `json:"purged"`
+}
+
+// pullZoneURL returns the URL remote is served at through the
+// configured pull zone.
+func (f *Fs) pullZoneURL(remote string) string {
+	base := f.opt.PullZoneHostname
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+	base = strings.TrimSuffix(base, "/")
+	// The pull zone serves the storage zone root, so the URL path is
+	// the stored path without the zone name
+	return base + strings.TrimPrefix(f.getFullFilePath(remote), f.opt.StorageZone)
+}
+
+// purgeCache implements the purge-cache command
+func (f *Fs) purgeCache(ctx context.Context, arg []string) (interface{}, error) {
+	if f.mgmt == nil {
+		return nil, errors.New("purging the pull zone cache requires api_key to be set")
+	}
+	if f.opt.PullZoneHostname == "" {
+		return nil, errors.New("purging the pull zone cache requires pull_zone_hostname to be set")
+	}
+	var urls []string
+	if len(arg) == 0 {
+		u := f.pullZoneURL("")
+		if strings.TrimPrefix(f.getFullFilePath(""), f.opt.StorageZone) == "" {
+			// The remote points at the zone root - purge everything
+			u += "/*"
+		}
+		urls = []string{u}
+	} else {
+		for _, remote := range arg {
+			urls = append(urls, f.pullZoneURL(remote))
+		}
+	}
+	for _, u := range urls {
+		opts := rest.Opts{
+			Method:     "POST",
+			Path:       "/purge",
+			Parameters: url.Values{"url": {u}, "async": {"false"}},
+			NoResponse: true,
+		}
+		err := f.pacer.Call(func() (bool, error) {
+			resp, err := f.mgmt.Call(ctx, &opts)
+			return f.shouldRetry(ctx, resp, err)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge %q: %w", u, err)
+		}
+		fs.Infof(f, "purge-cache: purged %q", u)
+	}
+	return purgeResult{Purged: urls}, nil
+}
+
+// dirCacheFlush implements the dir-cache-flush command
+func (f *Fs) dirCacheFlush(arg []string) (interface{}, error) {
+	if len(arg) == 0 {
+		f.cache.ClearAll()
+		return "flushed the whole directory cache", nil
+	}
+	for _, dir := range arg {
+		f.cache.ClearUnder(strings.Trim(dir, "/"))
+	}
+	return fmt.Sprintf("flushed %d directories and their subtrees from the cache", len(arg)), nil
+}
+
+// statsResult is the outcome of a stats command
+type statsResult struct {
+	Zone               string   `json:"zone"`
+	Region             string   `json:"region"`
+	ReplicationRegions []string `json:"replicationRegions,omitempty"`
+	StorageUsed        int64    `json:"storageUsed"`
+	StorageUsedHuman   string   `json:"storageUsedHuman"`
+	FilesStored        int64    `json:"filesStored"`
+}
+
+// stats implements the stats command
+func (f *Fs) stats(ctx context.Context) (interface{}, error) {
+	if f.mgmt == nil {
+		return nil, errors.New("fetching zone statistics requires api_key to be set")
+	}
+	opts := rest.Opts{
+		Method: "GET",
+		Path:   "/storagezone",
+	}
+	var zones []api.StorageZone
+	err := f.pacer.Call(func() (bool, error) {
+		resp, err := f.mgmt.CallJSON(ctx, &opts, nil, &zones)
+		return f.shouldRetry(ctx, resp, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch zone statistics: %w", err)
+	}
+	for _, zone := range zones {
+		if !strings.EqualFold(zone.Name, f.opt.StorageZone) {
+			continue
+		}
+		return statsResult{
+			Zone:               zone.Name,
+			Region:             zone.Region,
+			ReplicationRegions: zone.ReplicationRegions,
+			StorageUsed:        zone.StorageUsed,
+			StorageUsedHuman:   fs.SizeSuffix(zone.StorageUsed).String(),
+			FilesStored:        zone.FilesStored,
+		}, nil
+	}
+	return nil, fmt.Errorf("storage zone %q not found in the account", f.opt.StorageZone)
+}
+
+// uploadBenchmark implements the upload-benchmark command
+func (f *Fs) uploadBenchmark(ctx context.Context, opt map[string]string) (interface{}, error) {
+	sizesOpt := opt["size"]
+	if sizesOpt == "" {
+		sizesOpt = "10Mi"
+	}
+	var sizes []fs.SizeSuffix
+	for _, s := range strings.Split(sizesOpt, ",") {
+		var size fs.SizeSuffix
+		if err := size.Set(strings.TrimSpace(s)); err != nil {
+			return nil, fmt.Errorf("invalid size %q: %w", s, err)
+		}
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid size %q: must be positive", s)
+		}
+		sizes = append(sizes, size)
+	}
+	remote := opt["remote"]
+	if remote == "" {
+		remote = ".rclone-benchmark"
+	}
+	results := make([]benchmarkResult, 0, len(sizes))
+	for _, size := range sizes {
+		result, err := f.benchmarkUpload(ctx, remote, int64(size))
+		if err != nil {
+			return nil, err
+		}
+		fs.Infof(f, "upload-benchmark: %v in %.2fs = %s", size, result.Seconds, result.Speed)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// benchmarkUpload uploads size bytes of random data to remote, timing
+// it, and deletes the object again whatever the outcome.
+func (f *Fs) benchmarkUpload(ctx context.Context, remote string, size int64) (result benchmarkResult, err error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return result, err
+	}
+	sum := sha256.Sum256(data)
+	defer func() {
+		removeErr := f.remove(ctx, remote)
+		if removeErr != nil && removeErr != fs.ErrorObjectNotFound {
+			fs.Errorf(f, "upload-benchmark: failed to delete test object %q: %v", remote, removeErr)
+			if err == nil {
+				err = removeErr
+			}
+		}
+		f.clearDirCache(remote)
+	}()
+	start := time.Now()
+	resp, err := f.upload(ctx, remote, bytes.NewReader(data), size, hex.EncodeToString(sum[:]), nil)
+	if err != nil {
+		return result, err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("benchmark upload failed: %w", uploadStatusErr(resp))
+	}
+	elapsed := time.Since(start).Seconds()
+	bps := float64(size) / elapsed
+	return benchmarkResult{
+		Size:           size,
+		Seconds:        elapsed,
+		BytesPerSecond: bps,
+		Speed:          fs.SizeSuffix(int64(bps)).String() + "/s",
+	}, nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Commander = (*Fs)(nil)
+)
@@ -0,0 +1,570 @@
+// Packing of many small files into shared pack objects.
+//
+// Uploading thousands of tiny files one PUT at a time is latency
+// bound. bunny has no batch upload endpoint, so with pack_small_files
+// set the backend accumulates small uploads per directory and writes
+// them as a single JSON pack object holding the content and metadata
+// of each file. Listings expand pack objects back into their files and
+// reads are served from the decoded pack, so the packing is invisible
+// to callers.
+//
+// The pack for a directory is rewritten synchronously on every Put so
+// an upload is durable before it reports success, growing in place
+// until it reaches the flush thresholds and a fresh pack is started.
+// Decoded pack documents are shared with readers and never mutated
+// once published - rewrites build a new document and swap it in.
+
+package bunny
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+const (
+	// packPrefix and packSuffix bracket the names of pack objects
+	packPrefix = ".rclone-pack-"
+	packSuffix = ".json"
+	// packFlushSize is the content size at which a pack stops growing
+	// and a fresh pack object is started for the directory
+	packFlushSize = 4 * 1024 * 1024
+	// packFlushCount is the file count at which a pack stops growing
+	// and a fresh pack object is started for the directory
+	packFlushCount = 256
+)
+
+// packedFile is one file stored inside a pack object
+type packedFile struct {
+	Data    []byte    `json:"data"` // encoded as base64 by encoding/json
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// packDoc is the JSON document stored as a pack object, keyed by the
+// leaf names of the files within it
+type packDoc struct {
+	Files map[string]packedFile `json:"files"`
+}
+
+// pendingPack accumulates small files for one directory until it is
+// flushed
+type pendingPack struct {
+	doc  *packDoc
+	size int64 // total content bytes pending
+}
+
+// isPackName reports whether leaf names a pack object
+func isPackName(leaf string) bool {
+	return strings.HasPrefix(leaf, packPrefix) && strings.HasSuffix(leaf, packSuffix)
+}
+
+// packSmallFile reports whether the file at remote with the given size
+// should go into a pack rather than being uploaded individually.
+func (f *Fs) packSmallFile(remote string, size int64) bool {
+	if f.opt.PackSmallFiles <= 0 || size < 0 || size >= int64(f.opt.PackSmallFiles) {
+		return false
+	}
+	// Never pack the backend's own bookkeeping objects
+	return !strings.HasSuffix(remote, metadataSidecarSuffix) && !isPackName(path.Base(remote))
+}
+
+// packDirKey returns the pending pack key for the directory containing
+// remote
+func packDirKey(remote string) (dir, leaf string) {
+	dir = path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	return dir, path.Base(remote)
+}
+
+// newPackedObject builds the Object for a file held in a pack.
+//
+// packRemote is the pack object holding it, or "" while the file is
+// still pending in memory.
+func (f *Fs) newPackedObject(remote, packRemote string, pf packedFile) *Object {
+	return &Object{
+		fs:           f,
+		remote:       remote,
+		size:         int64(len(pf.Data)),
+		modTime:      pf.ModTime,
+		sha256:       pf.SHA256,
+		packed:       true,
+		packRemote:   packRemote,
+		metaComplete: true,
+	}
+}
+
+// putPacked stores a small upload in its directory's pack, flushing
+// the pack before reporting success so the content is durable - a
+// move that deletes its source right after Put must not be able to
+// lose data to a crash.
+func (f *Fs) putPacked(ctx context.Context, in io.Reader, src fs.ObjectInfo) (fs.Object, error) {
+	remote := src.Remote()
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	pf := packedFile{
+		Data:    data,
+		ModTime: src.ModTime(ctx),
+		SHA256:  hex.EncodeToString(sum[:]),
+	}
+	dir, leaf := packDirKey(remote)
+	f.packMu.Lock()
+	p := f.packPending[dir]
+	if p == nil {
+		if f.packPending == nil {
+			f.packPending = make(map[string]*pendingPack)
+		}
+		p = &pendingPack{doc: &packDoc{Files: make(map[string]packedFile)}}
+		f.packPending[dir] = p
+	}
+	if old, ok := p.doc.Files[leaf]; ok {
+		p.size -= int64(len(old.Data))
+	}
+	p.doc.Files[leaf] = pf
+	p.size += int64(len(data))
+	f.packMu.Unlock()
+	if err := f.flushPack(ctx, dir); err != nil {
+		return nil, err
+	}
+	return f.newPackedObject(remote, "", pf), nil
+}
+
+// flushPack writes dir's pending files into its current pack object,
+// merged with the files the pack already holds. On failure the
+// pending files are kept so a later flush can retry.
+func (f *Fs) flushPack(ctx context.Context, dir string) (err error) {
+	// One pack write at a time, or concurrent Puts could overwrite the
+	// pack object with stale contents
+	f.packWriteMu.Lock()
+	defer f.packWriteMu.Unlock()
+	f.packMu.Lock()
+	p := f.packPending[dir]
+	if p == nil || len(p.doc.Files) == 0 {
+		delete(f.packPending, dir)
+		f.packMu.Unlock()
+		return nil
+	}
+	delete(f.packPending, dir)
+	name := f.packNames[dir]
+	if name == "" {
+		f.packSeq++
+		name = fmt.Sprintf("%s%d-%d%s", packPrefix, time.Now().UnixNano(), f.packSeq, packSuffix)
+		if f.packNames == nil {
+			f.packNames = make(map[string]string)
+		}
+		f.packNames[dir] = name
+	}
+	packRemote := path.Join(dir, name)
+	// Build a fresh merged document - the one in the cache is shared
+	// with readers and must not be touched
+	merged := &packDoc{Files: make(map[string]packedFile)}
+	var mergedSize int64
+	if stored := f.packCache[packRemote]; stored != nil {
+		for leaf, pf := range stored.Files {
+			merged.Files[leaf] = pf
+			mergedSize += int64(len(pf.Data))
+		}
+	}
+	for leaf, pf := range p.doc.Files {
+		if old, ok := merged.Files[leaf]; ok {
+			mergedSize -= int64(len(old.Data))
+		}
+		merged.Files[leaf] = pf
+		mergedSize += int64(len(pf.Data))
+	}
+	data, err := json.Marshal(merged)
+	f.packMu.Unlock()
+	if err != nil {
+		return err
+	}
+	requeue := func() {
+		// Put the files back so they aren't lost and Shutdown can
+		// retry the flush
+		f.packMu.Lock()
+		defer f.packMu.Unlock()
+		if f.packPending == nil {
+			f.packPending = make(map[string]*pendingPack)
+		}
+		current := f.packPending[dir]
+		if current == nil {
+			f.packPending[dir] = p
+			return
+		}
+		for leaf, pf := range p.doc.Files {
+			if _, ok := current.doc.Files[leaf]; ok {
+				continue // a newer upload wins
+			}
+			current.doc.Files[leaf] = pf
+			current.size += int64(len(pf.Data))
+		}
+	}
+	sum := sha256.Sum256(data)
+	resp, err := f.upload(ctx, packRemote, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]), nil)
+	if err != nil {
+		requeue()
+		return fmt.Errorf("failed to write pack object %q: %w", packRemote, err)
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		requeue()
+		return fmt.Errorf("failed to write pack object %q: %w", packRemote, uploadStatusErr(resp))
+	}
+	f.packMu.Lock()
+	if f.packCache == nil {
+		f.packCache = make(map[string]*packDoc)
+	}
+	f.packCache[packRemote] = merged
+	if mergedSize >= packFlushSize || len(merged.Files) >= packFlushCount {
+		// The pack is full - the directory's next small file starts a
+		// fresh one
+		delete(f.packNames, dir)
+	}
+	f.packMu.Unlock()
+	f.cache.Clear(dir)
+	return nil
+}
+
+// flushAllPacks writes out every pending pack
+func (f *Fs) flushAllPacks(ctx context.Context) error {
+	f.packMu.Lock()
+	dirs := make([]string, 0, len(f.packPending))
+	for dir := range f.packPending {
+		dirs = append(dirs, dir)
+	}
+	f.packMu.Unlock()
+	for _, dir := range dirs {
+		if err := f.flushPack(ctx, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPack fetches and decodes the pack object at packRemote, caching
+// the decoded document for the session. Cached documents are shared
+// with readers and never mutated - flushes and removals build a new
+// document and replace the cache entry once the rewrite is stored.
+func (f *Fs) readPack(ctx context.Context, packRemote string) (*packDoc, error) {
+	f.packMu.Lock()
+	doc, ok := f.packCache[packRemote]
+	f.packMu.Unlock()
+	if ok {
+		return doc, nil
+	}
+	po := &Object{fs: f, remote: packRemote, size: -1}
+	rc, err := po.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rc)
+	closeErr := rc.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc = new(packDoc)
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("couldn't decode pack object %q: %w", packRemote, err)
+	}
+	f.packMu.Lock()
+	if f.packCache == nil {
+		f.packCache = make(map[string]*packDoc)
+	}
+	f.packCache[packRemote] = doc
+	f.packMu.Unlock()
+	return doc, nil
+}
+
+// packEntries returns Objects for the packed files of dir - both those
+// in the pack objects of the listing and those still pending in
+// memory.
+func (f *Fs) packEntries(ctx context.Context, dir string, list DirList) ([]*Object, error) {
+	// Snapshot the pending files under the lock - a pending entry is
+	// newer than any stored copy of the same file (left over from a
+	// failed flush), so it wins
+	pending := map[string]packedFile{}
+	f.packMu.Lock()
+	if p := f.packPending[dir]; p != nil {
+		for name, pf := range p.doc.Files {
+			pending[name] = pf
+		}
+	}
+	f.packMu.Unlock()
+	var objs []*Object
+	for i := range list {
+		item := &list[i]
+		if item.IsDirectory || !isPackName(item.ObjectName) {
+			continue
+		}
+		packRemote := path.Join(dir, item.ObjectName)
+		doc, err := f.readPack(ctx, packRemote)
+		if err != nil {
+			return nil, err
+		}
+		for name, pf := range doc.Files {
+			if _, ok := pending[name]; ok {
+				continue
+			}
+			objs = append(objs, f.newPackedObject(path.Join(dir, name), packRemote, pf))
+		}
+	}
+	for name, pf := range pending {
+		objs = append(objs, f.newPackedObject(path.Join(dir, name), "", pf))
+	}
+	return objs, nil
+}
+
+// packFind looks remote up in the pending and stored packs of its
+// directory, returning fs.ErrorObjectNotFound if no pack holds it.
+func (f *Fs) packFind(ctx context.Context, remote string) (*Object, error) {
+	dir, leaf := packDirKey(remote)
+	f.packMu.Lock()
+	if p := f.packPending[dir]; p != nil {
+		if pf, ok := p.doc.Files[leaf]; ok {
+			f.packMu.Unlock()
+			return f.newPackedObject(remote, "", pf), nil
+		}
+	}
+	f.packMu.Unlock()
+	list, err := f.list(ctx, dir)
+	if err != nil {
+		if err == fs.ErrorDirNotFound {
+			return nil, fs.ErrorObjectNotFound
+		}
+		return nil, err
+	}
+	for i := range list {
+		item := &list[i]
+		if item.IsDirectory || !isPackName(item.ObjectName) {
+			continue
+		}
+		packRemote := path.Join(dir, item.ObjectName)
+		doc, err := f.readPack(ctx, packRemote)
+		if err != nil {
+			return nil, err
+		}
+		if pf, ok := doc.Files[leaf]; ok {
+			return f.newPackedObject(remote, packRemote, pf), nil
+		}
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// removePacked deletes the packed file o, dropping pending entries
+// from memory and rewriting (or deleting, when emptied) stored packs.
+func (f *Fs) removePacked(ctx context.Context, o *Object) error {
+	dir, leaf := packDirKey(o.remote)
+	f.packMu.Lock()
+	if p := f.packPending[dir]; p != nil {
+		if pf, ok := p.doc.Files[leaf]; ok {
+			delete(p.doc.Files, leaf)
+			p.size -= int64(len(pf.Data))
+			f.packMu.Unlock()
+			return nil
+		}
+	}
+	f.packMu.Unlock()
+	packRemote := o.packRemote
+	if packRemote == "" {
+		found, err := f.packFind(ctx, o.remote)
+		if err != nil {
+			return err
+		}
+		packRemote = found.packRemote
+		if packRemote == "" {
+			return fs.ErrorObjectNotFound
+		}
+	}
+	// One pack write at a time - see flushPack. Taken before reading
+	// the pack so the rewrite can't be based on a stale document.
+	f.packWriteMu.Lock()
+	defer f.packWriteMu.Unlock()
+	doc, err := f.readPack(ctx, packRemote)
+	if err != nil {
+		return err
+	}
+	// The cached document is shared with readers, so build the
+	// rewritten pack as a new document and only swap it into the cache
+	// once the rewrite has landed - a failed rewrite must not leave
+	// the cache claiming the file is gone while the zone still has it
+	rewritten := &packDoc{Files: make(map[string]packedFile, len(doc.Files))}
+	found := false
+	for name, pf := range doc.Files {
+		if name == leaf {
+			found = true
+			continue
+		}
+		rewritten.Files[name] = pf
+	}
+	if !found {
+		return fs.ErrorObjectNotFound
+	}
+	if len(rewritten.Files) == 0 {
+		if err := f.remove(ctx, packRemote); err != nil && err != fs.ErrorObjectNotFound {
+			return err
+		}
+		f.packMu.Lock()
+		delete(f.packCache, packRemote)
+		if f.packNames[dir] == path.Base(packRemote) {
+			delete(f.packNames, dir)
+		}
+		f.packMu.Unlock()
+	} else {
+		if err := f.writePack(ctx, packRemote, rewritten); err != nil {
+			return err
+		}
+	}
+	f.cache.Clear(dir)
+	return nil
+}
+
+// writePack stores doc as the pack object at packRemote, swapping it
+// into the cache once the write has landed. Must be called with
+// packWriteMu held.
+func (f *Fs) writePack(ctx context.Context, packRemote string, doc *packDoc) (err error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	resp, err := f.upload(ctx, packRemote, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]), nil)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite pack object %q: %w", packRemote, err)
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to rewrite pack object %q: %w", packRemote, uploadStatusErr(resp))
+	}
+	f.packMu.Lock()
+	if f.packCache == nil {
+		f.packCache = make(map[string]*packDoc)
+	}
+	f.packCache[packRemote] = doc
+	f.packMu.Unlock()
+	return nil
+}
+
+// setModTimePacked updates the stored modification time of the packed
+// file o by rewriting the entry inside its pack - re-uploading the
+// content as an individual object would leave the pack's copy behind
+// and the name would list twice.
+func (f *Fs) setModTimePacked(ctx context.Context, o *Object, t time.Time) error {
+	dir, leaf := packDirKey(o.remote)
+	// A pending copy just has its timestamp updated in memory before
+	// the flush
+	f.packMu.Lock()
+	if p := f.packPending[dir]; p != nil {
+		if pf, ok := p.doc.Files[leaf]; ok {
+			pf.ModTime = t
+			p.doc.Files[leaf] = pf
+			f.packMu.Unlock()
+			return f.flushPack(ctx, dir)
+		}
+	}
+	f.packMu.Unlock()
+	packRemote := o.packRemote
+	if packRemote == "" {
+		found, err := f.packFind(ctx, o.remote)
+		if err != nil {
+			return err
+		}
+		packRemote = found.packRemote
+		if packRemote == "" {
+			return fs.ErrorObjectNotFound
+		}
+	}
+	// One pack write at a time - see flushPack. Taken before reading
+	// the pack so the rewrite can't be based on a stale document.
+	f.packWriteMu.Lock()
+	defer f.packWriteMu.Unlock()
+	doc, err := f.readPack(ctx, packRemote)
+	if err != nil {
+		return err
+	}
+	pf, ok := doc.Files[leaf]
+	if !ok {
+		return fs.ErrorObjectNotFound
+	}
+	pf.ModTime = t
+	// The cached document is shared with readers - rewrite a copy
+	rewritten := &packDoc{Files: make(map[string]packedFile, len(doc.Files))}
+	for name, file := range doc.Files {
+		rewritten.Files[name] = file
+	}
+	rewritten.Files[leaf] = pf
+	if err := f.writePack(ctx, packRemote, rewritten); err != nil {
+		return err
+	}
+	f.cache.Clear(dir)
+	return nil
+}
+
+// openPacked serves a packed file's content from its pack
+func (o *Object) openPacked(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	dir, leaf := packDirKey(o.remote)
+	var (
+		data  []byte
+		found bool
+	)
+	o.fs.packMu.Lock()
+	if p := o.fs.packPending[dir]; p != nil {
+		if pf, ok := p.doc.Files[leaf]; ok {
+			data, found = pf.Data, true
+		}
+	}
+	o.fs.packMu.Unlock()
+	if !found {
+		packRemote := o.packRemote
+		if packRemote == "" {
+			obj, err := o.fs.packFind(ctx, o.remote)
+			if err != nil {
+				return nil, err
+			}
+			packRemote = obj.packRemote
+		}
+		doc, err := o.fs.readPack(ctx, packRemote)
+		if err != nil {
+			return nil, err
+		}
+		pf, ok := doc.Files[leaf]
+		if !ok {
+			return nil, fs.ErrorObjectNotFound
+		}
+		data = pf.Data
+	}
+	// Apply any range options to the in-memory content
+	offset, limit := int64(0), int64(-1)
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(int64(len(data)))
+		}
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if limit >= 0 && limit < int64(len(data)) {
+		data = data[:limit]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
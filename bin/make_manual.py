@@ -33,6 +33,7 @@ docs = [
     "s3.md",
     "b2.md",
     "box.md",
+    "bunny.md",
     "cache.md",
     "chunker.md",
     "sharefile.md",